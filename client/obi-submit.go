@@ -160,7 +160,9 @@ func getEndpoints(infrastructure string) string {
 	return masterService.Status.LoadBalancer.Ingress[0].IP
 }
 
-func prepareJobRequest(jobType string, execPath string, infrastructure string, priority int32) JobSubmissionRequest {
+func prepareJobRequest(jobType string, execPath string, infrastructure string, priority int32,
+	deadline time.Duration, profile string, affinity, antiAffinity []string, maxRetries int32,
+	webhooks []string, webhookSecret string) JobSubmissionRequest {
 	var jobRequestType JobSubmissionRequest_JobType
 
 	// fill job request struct
@@ -199,6 +201,19 @@ func prepareJobRequest(jobType string, execPath string, infrastructure string, p
 		Type:                 jobRequestType,
 		JobArgs:              jobArgs,
 		Priority:             priority,
+		Profile:              profile,
+		Affinity:             affinity,
+		AntiAffinity:         antiAffinity,
+		MaxRetries:           maxRetries,
+	}
+	for _, url := range webhooks {
+		jobRequest.Webhooks = append(jobRequest.Webhooks, &WebhookRequest{
+			Url:    url,
+			Secret: webhookSecret,
+		})
+	}
+	if deadline > 0 {
+		jobRequest.Deadline = time.Now().Add(deadline).Unix()
 	}
 
 	return jobRequest
@@ -213,6 +228,14 @@ func main() {
 	jobType := flag.StringP("type", "t", "", "a string")
 	priority := flag.Int32P("priority", "p", 0, "an int")
 	wait := flag.BoolP("wait", "w", false, "wait for job completion")
+	deadline := flag.DurationP("deadline", "d", 0, "time from now within which the job should complete, e.g. 2h")
+	profile := flag.String("profile", "", "cluster profile the job must run on, e.g. high-performance")
+	affinity := flag.StringSlice("affinity", nil, "labels of the jobs to run on the same cluster whenever possible")
+	antiAffinity := flag.StringSlice("anti-affinity", nil, "labels of the jobs which must not run on the same cluster")
+	maxRetries := flag.Int32("max-retries", 1, "times the job is submitted again if its cluster is lost")
+	webhooks := flag.StringSlice("webhook", nil, "URLs notified when the job finishes")
+	webhookSecret := flag.String("webhook-secret", os.Getenv("OBI_WEBHOOK_SECRET"),
+		"key signing the webhook payloads, OBI_WEBHOOK_SECRET by default")
 	deleteCreds := flag.Bool("reset-creds", false, "delete local credentials")
 	useK8sSecret := flag.Bool("k8s-secret", false, "use kubernetes secret")
 
@@ -223,7 +246,8 @@ func main() {
 		keyring.Delete("obi", "password")
 	}
 
-	jobRequest := prepareJobRequest(*jobType, *execPath, *infrastructure, *priority)
+	jobRequest := prepareJobRequest(*jobType, *execPath, *infrastructure, *priority, *deadline, *profile,
+		*affinity, *antiAffinity, *maxRetries, *webhooks, *webhookSecret)
 
 	if *useK8sSecret {
 
@@ -0,0 +1,218 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"obi/master/config"
+	"obi/master/events"
+	"obi/master/persistent"
+	"obi/master/scheduling"
+	"obi/master/utils"
+	"strconv"
+)
+
+// requireAdmin checks that the user issuing the request is an administrator
+func requireAdmin(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md["userid"]) == 0 {
+		return status.Errorf(codes.PermissionDenied, "Missing credentials")
+	}
+	userID, _ := strconv.Atoi(md["userid"][0])
+
+	admin, err := persistent.IsAdmin(userID)
+	if err != nil {
+		logrus.WithField("error", err).Error("Could not check administration rights")
+		return status.Errorf(codes.Internal, "Could not check administration rights")
+	}
+	if !admin {
+		return status.Errorf(codes.PermissionDenied, "Administration rights required")
+	}
+	return nil
+}
+
+// infrastructureScheduler returns the scheduler of the requested infrastructure
+// @param name is the name of the infrastructure, the default one if empty
+func (m *ObiMaster) infrastructureScheduler(name string) (*scheduling.Scheduler, error) {
+	if name == "" {
+		name = config.Get().DefaultInfrastructure
+	}
+	scheduler, ok := m.schedulers[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Unknown infrastructure '%s'", name)
+	}
+	return scheduler, nil
+}
+
+// GetSchedulerState remote procedure call used to inspect the bins waiting in each scheduling level
+func (m *ObiMaster) GetSchedulerState(ctx context.Context,
+		request *SchedulerStateRequest) (*SchedulerStateResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	scheduler, err := m.infrastructureScheduler(request.Infrastructure)
+	if err != nil {
+		return nil, err
+	}
+
+	now := utils.Now()
+	response := &SchedulerStateResponse{}
+	for _, level := range scheduler.State() {
+		levelState := &SchedulingLevelState{
+			Level:             level.Level,
+			Policy:            level.Policy,
+			Packing:           level.Packing,
+			Timeout:           level.Timeout,
+			BinCapacity:       level.BinCapacity,
+			MaxMemoryMB:       level.MaxMemoryMB,
+			MaxVCores:         level.MaxVCores,
+			SecondsUntilFlush: -1,
+			QueuedJobs:        int32(level.QueuedJobs),
+			Profile:           level.Profile,
+		}
+		if !level.NextFlush.IsZero() {
+			levelState.SecondsUntilFlush = int32(level.NextFlush.Sub(now).Seconds())
+			if levelState.SecondsUntilFlush < 0 {
+				levelState.SecondsUntilFlush = 0
+			}
+		}
+
+		for _, b := range level.Bins {
+			binState := &BinState{
+				CumulativeValue: b.CumulativeValue,
+				MemoryMB:        b.Demand.MemoryMB,
+				VCores:          b.Demand.VCores,
+				AgeSeconds:      int32(now.Sub(b.CreationTimestamp).Seconds()),
+				Profile:         b.Profile,
+			}
+			for _, job := range b.Jobs {
+				binState.Jobs = append(binState.Jobs, &ScheduledJob{
+					JobID:             int32(job.ID),
+					Author:            int32(job.Author),
+					PredictedDuration: job.PredictedDuration,
+					PredictedMemoryMB: job.PredictedMemoryMB,
+					PredictedVCores:   job.PredictedVCores,
+					Affinity:          job.Affinity,
+					AntiAffinity:      job.AntiAffinity,
+				})
+			}
+			levelState.Bins = append(levelState.Bins, binState)
+		}
+		response.Levels = append(response.Levels, levelState)
+	}
+
+	return response, nil
+}
+
+// StreamFlushEvents remote procedure call used to follow the deployment of the bins flushed by the scheduler,
+// until the client closes the stream
+func (m *ObiMaster) StreamFlushEvents(request *SchedulerStateRequest,
+		stream ObiMaster_StreamFlushEventsServer) error {
+	if err := requireAdmin(stream.Context()); err != nil {
+		return err
+	}
+
+	infrastructure := request.Infrastructure
+	if infrastructure == "" {
+		infrastructure = config.Get().DefaultInfrastructure
+	}
+	if _, err := m.infrastructureScheduler(infrastructure); err != nil {
+		return err
+	}
+
+	flushes, unsubscribe := events.Subscribe(events.Filter{
+		Types:          []events.Type{events.BinFlushed},
+		Infrastructure: infrastructure,
+	})
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-flushes:
+			flushEvent := &FlushEvent{
+				Level:       event.Level,
+				ClusterName: event.ClusterName,
+				Reused:      event.Reused,
+				Queued:      event.Queued,
+				Reason:      event.Reason,
+				Timestamp:   event.Timestamp.Unix(),
+			}
+			for _, job := range event.Jobs {
+				flushEvent.JobIDs = append(flushEvent.JobIDs, int32(job.ID))
+			}
+			if err := stream.Send(flushEvent); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamEvents remote procedure call used to follow the state changes of the jobs and of the clusters,
+// until the client closes the stream
+func (m *ObiMaster) StreamEvents(request *EventsRequest, stream ObiMaster_StreamEventsServer) error {
+	if err := requireAdmin(stream.Context()); err != nil {
+		return err
+	}
+
+	filter := events.Filter{
+		JobID:       int(request.JobID),
+		ClusterName: request.ClusterName,
+	}
+	for _, name := range request.Types {
+		known := false
+		for _, t := range events.Types {
+			if string(t) == name {
+				known = true
+			}
+		}
+		if !known {
+			return status.Errorf(codes.InvalidArgument, "Unknown event type '%s'", name)
+		}
+		filter.Types = append(filter.Types, events.Type(name))
+	}
+
+	subscription, unsubscribe := events.Subscribe(filter)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-subscription:
+			err := stream.Send(&Event{
+				Type:             string(event.Type),
+				Timestamp:        event.Timestamp.Unix(),
+				JobID:            int32(event.JobID),
+				ClusterName:      event.ClusterName,
+				Level:            event.Level,
+				Profile:          event.Profile,
+				Status:           event.Status,
+				WorkerNodes:      event.WorkerNodes,
+				PreemptibleNodes: event.PreemptibleNodes,
+				Delta:            event.Delta,
+				Applied:          event.Applied,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -16,10 +16,12 @@ package autoscaler
 
 import (
 	"github.com/sirupsen/logrus"
+	"obi/master/events"
 	"obi/master/model"
 	"obi/master/utils"
 	"time"
 	"math"
+	"sync"
 )
 
 // Autoscaler module resizes the managed cluster according to the policy.
@@ -31,6 +33,9 @@ type Autoscaler struct {
 	managedCluster model.Scalable
 	allowDownscale bool
 	maxAbsDelta int16
+	// policyLock guards Policy, which may be replaced while the autoscaler routine is running
+	policyLock sync.RWMutex
+	stopOnce   sync.Once
 }
 
 // Policy defines the primitive methods that must be implemented for any type of autoscaling policy
@@ -52,15 +57,23 @@ func New(
 	maxAbsDelta int16,
 	) *Autoscaler {
 	return &Autoscaler{
-		policy,
-		timeout,
-		make(chan struct{}),
-		cluster,
-		downscalePermitted,
-		maxAbsDelta,
+		Policy:         policy,
+		Timeout:        timeout,
+		quit:           make(chan struct{}),
+		managedCluster: cluster,
+		allowDownscale: downscalePermitted,
+		maxAbsDelta:    maxAbsDelta,
 	}
 }
 
+// SetPolicy replaces the scaling policy, also while the autoscaler is running
+// @param policy is the new policy to apply
+func (as *Autoscaler) SetPolicy(policy Policy) {
+	as.policyLock.Lock()
+	defer as.policyLock.Unlock()
+	as.Policy = policy
+}
+
 
 // StartMonitoring starts the execution of the autoscaler
 func (as *Autoscaler) StartMonitoring() {
@@ -69,16 +82,34 @@ func (as *Autoscaler) StartMonitoring() {
 	go autoscalerRoutine(as)
 }
 
-// StopMonitoring stops the execution of the autoscaler
+// StopMonitoring stops the execution of the autoscaler, it can be invoked more than once
 func (as *Autoscaler) StopMonitoring() {
-	close(as.quit)
+	as.stopOnce.Do(func() {
+		close(as.quit)
+	})
+}
+
+// Step applies the scaling policy once to the managed cluster
+func (as *Autoscaler) Step() {
+	as.policyLock.RLock()
+	policy := as.Policy
+	as.policyLock.RUnlock()
+	delta := policy.Apply(as.managedCluster.(model.ClusterBaseInterface).GetMetricsWindow())
+	bounded := math.Abs(float64(delta)) <= float64(as.maxAbsDelta)
+
+	applied := (delta < 0 && as.allowDownscale) || delta > 0 && bounded == true
+	if applied {
+		as.managedCluster.Scale(delta)
+	}
+	if delta != 0 {
+		events.PublishDecision(as.managedCluster.(model.ClusterBaseInterface), delta, applied)
+	}
 }
 
 // goroutine which apply the scaling policy at each time interval. It will be stop when an empty object is inserted in
 // the `quit` channel
 // @param as is the autoscaler
 func autoscalerRoutine(as *Autoscaler) {
-	var delta int32
 	for {
 		select {
 		case <-as.quit:
@@ -86,12 +117,7 @@ func autoscalerRoutine(as *Autoscaler) {
 				"Closing autoscaler routine.")
 			return
 		default:
-			delta = as.Policy.Apply(as.managedCluster.(model.ClusterBaseInterface).GetMetricsWindow())
-			bounded := math.Abs(float64(delta)) <= float64(as.maxAbsDelta)
-
-			if (delta < 0 && as.allowDownscale) || delta > 0 && bounded == true {
-				as.managedCluster.Scale(delta)
-			}
+			as.Step()
 			time.Sleep(time.Duration(as.Timeout) * time.Second)
 		}
 	}
@@ -15,9 +15,9 @@
 package policies
 
 import (
+	"obi/master/config"
 	"context"
 	"fmt"
-		"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"log"
 	"obi/master/model"
@@ -80,9 +80,7 @@ func (p *ExpWorkloadPolicy) Apply(metricsWindow *utils.ConcurrentSlice) int32 {
 			p.record.MetricsAfter = &previousMetrics
 			p.record.PerformanceAfter = performance
 			// Send data point
-			serverAddr := fmt.Sprintf("%s:%s",
-				viper.GetString("predictorHost"),
-				viper.GetString("predictorPort"))
+			serverAddr := config.Get().PredictorAddress()
 			conn, err := grpc.Dial(serverAddr, grpc.WithInsecure()) // TODO: encrypt communication
 			if err != nil {
 				log.Fatalf("fail to dial: %v", err)
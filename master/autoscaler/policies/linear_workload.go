@@ -15,10 +15,10 @@
 package policies
 
 import (
+	"obi/master/config"
 	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"log"
 	"math/rand"
@@ -89,9 +89,7 @@ func (p *LinearWorkloadPolicy) Apply(metricsWindow *utils.ConcurrentSlice) int32
 			p.record.PerformanceAfter = performance
 			// Send data point
 			logrus.WithField("data", *p.record).Info("Sending autoscaler data to predictor")
-			serverAddr := fmt.Sprintf("%s:%s",
-				viper.GetString("predictorHost"),
-				viper.GetString("predictorPort"))
+			serverAddr := config.Get().PredictorAddress()
 			conn, err := grpc.Dial(serverAddr, grpc.WithInsecure()) // TODO: encrypt communication
 			if err != nil {
 				log.Fatalf("fail to dial: %v", err)
@@ -15,6 +15,7 @@
 package policies
 
 import (
+	"obi/master/config"
 	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
@@ -24,7 +25,6 @@ import (
 	"obi/master/model"
 	"obi/master/predictor"
 	"obi/master/utils"
-	"os"
 )
 
 // ScalingTrigger integer constant used to decide when to trigger autoscaler
@@ -40,9 +40,7 @@ type MLPolicy struct {
 // NewMLPolicy is the constructor of the MLPolicy struct
 func NewMLPolicy() *MLPolicy {
 	// Open predictor connection
-	serverAddr := fmt.Sprintf("%s:%d",
-		os.Getenv("PREDICTOR_SERVICE_DNS_NAME"),
-		8080)
+	serverAddr := config.Get().PredictorAddress()
 	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure()) // TODO: encrypt communication
 	if err != nil {
 		log.Fatalf("fail to dial: %v", err)
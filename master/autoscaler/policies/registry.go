@@ -0,0 +1,68 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package policies
+
+import (
+	"fmt"
+	"obi/master/autoscaler"
+	"obi/master/config"
+)
+
+// constructors of the policies which can be referenced by name in the cluster profiles
+var constructors = map[string]func(scale float32) autoscaler.Policy{
+	"workload": func(scale float32) autoscaler.Policy {
+		return NewWorkload(scale)
+	},
+	"linear-workload": func(scale float32) autoscaler.Policy {
+		return NewLinearWorkload()
+	},
+	"exp-workload": func(scale float32) autoscaler.Policy {
+		return NewExpWorkload()
+	},
+	"timeout": func(scale float32) autoscaler.Policy {
+		return NewTimeout()
+	},
+	"google": func(scale float32) autoscaler.Policy {
+		return NewGoogle()
+	},
+	"ml": func(scale float32) autoscaler.Policy {
+		return NewMLPolicy()
+	},
+}
+
+func init() {
+	config.AddValidator(func(c *config.Config) []error {
+		var errs []error
+		for name, profile := range c.ClusterProfiles {
+			if _, ok := constructors[profile.Autoscaling.Policy]; !ok {
+				errs = append(errs, fmt.Errorf("clusterProfiles.%s.autoscaling.policy: unknown policy '%s'",
+					name, profile.Autoscaling.Policy))
+			}
+		}
+		return errs
+	})
+}
+
+// New creates the autoscaling policy with the given name
+// @param name is the name of the policy, e.g. "workload"
+// @param scale is the scaling factor, only used by the "workload" policy
+// return the policy, false if no policy has the given name
+func New(name string, scale float32) (autoscaler.Policy, bool) {
+	constructor, ok := constructors[name]
+	if !ok {
+		return nil, false
+	}
+	return constructor(scale), true
+}
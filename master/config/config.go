@@ -0,0 +1,479 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"obi/master/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the configuration, e.g. OBI_MASTERPORT
+const EnvPrefix = "OBI"
+
+// BinMeasure defines how the size of a job is measured when packing it into a bin
+type BinMeasure int
+
+const (
+	// MeasureTime measures jobs by their predicted duration
+	MeasureTime BinMeasure = iota
+	// MeasureCount measures every job as one
+	MeasureCount
+	// MeasureResources measures jobs by their predicted memory, vcores and duration
+	MeasureResources
+)
+
+// BinMeasureNames descriptive names for the different bin measures
+var BinMeasureNames = map[BinMeasure]string{
+	MeasureTime:      "time",
+	MeasureCount:     "count",
+	MeasureResources: "resources",
+}
+
+// Config is the whole configuration of the OBI master
+type Config struct {
+	ProjectID     string `mapstructure:"projectId"`
+	Region        string
+	Zone          string
+	DataprocImage string `mapstructure:"dataproc-image"`
+	HeartbeatHost string
+	// HeartbeatPort is the port exposing the heartbeat service to the clusters
+	HeartbeatPort int
+	MasterPort    int
+	PredictorHost string
+	PredictorPort int
+	// SchedulingLevels are the levels of the scheduler, from the lowest to the highest one
+	SchedulingLevels                    []Level
+	AutoscalingFactorOneJobOneCluster   float32
+	AutoscalingFactorOneJobOneClusterHP float32
+	// Profiles of the clusters created for the two levels deploying each job on its own cluster
+	ProfileOneJobOneCluster   string
+	ProfileOneJobOneClusterHP string
+	// ClusterProfiles are the named cluster shapes, in addition to the built-in "standard" and "high-performance"
+	ClusterProfiles map[string]model.ClusterProfile
+	// ClusterProvisioningTime is the number of seconds expected to create a new cluster
+	ClusterProvisioningTime int32
+	// Limits bound all the clusters of the master, including the "one job one cluster" and the warm ones
+	Limits Limits
+	// Infrastructures are the named sets of clusters managed by the master, jobs are routed to them
+	// according to their submission. The default one is built from the settings above if not configured
+	Infrastructures       map[string]Infrastructure
+	DefaultInfrastructure string
+	// PriorityMap maps the job labels returned by the predictor to their scheduling level
+	PriorityMap map[string]int32
+	Pool        Pool
+	WarmPool    WarmPool
+	Reconciler  Reconciler
+	Webhooks    Webhooks
+	Simulation  Simulation
+	Fake        Fake
+}
+
+// Infrastructure is a set of clusters created on a platform at a given location, e.g. a GCP project
+// and region, with its own scheduling levels
+type Infrastructure struct {
+	Name      string
+	Platform  string
+	ProjectID string `mapstructure:"projectId"`
+	Region    string
+	Zone      string
+	// SchedulingLevels are the levels of the scheduler of the infrastructure, the global ones if empty
+	SchedulingLevels []Level
+	// inheritedLevels tells whether SchedulingLevels are a copy of the global levels
+	inheritedLevels bool
+	// Users (by ID) and Teams allowed to submit jobs to the infrastructure, everybody if both are empty
+	Users []int
+	Teams []string
+	// Livy is the static YARN cluster of the infrastructures of the "livy" platform
+	Livy Livy
+}
+
+// Livy describes how to reach a static YARN cluster fronted by Apache Livy
+type Livy struct {
+	// URL is the address of the Livy server, e.g. http://livy:8998
+	URL string `mapstructure:"url"`
+	// ResourceManagerURL is the address of the YARN ResourceManager, e.g. http://resourcemanager:8088
+	ResourceManagerURL string `mapstructure:"resourceManagerUrl"`
+	// ScaleHook is the URL receiving the scaling decisions of the autoscalers, scaling does nothing if empty
+	ScaleHook string
+	// Timeout is the number of seconds to wait for a response of Livy, of the ResourceManager or of the hook
+	Timeout int32
+	// PollInterval is the number of seconds between two checks of the batches and of the YARN metrics
+	PollInterval int32
+}
+
+// Allows checks whether a user can submit jobs to the infrastructure
+// @param userID is the identifier of the user
+// @param team is the team of the user, empty if the user belongs to none
+func (i *Infrastructure) Allows(userID int, team string) bool {
+	if len(i.Users) == 0 && len(i.Teams) == 0 {
+		return true
+	}
+	for _, user := range i.Users {
+		if user == userID {
+			return true
+		}
+	}
+	for _, t := range i.Teams {
+		if team != "" && t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// Level is the configuration of a scheduling level
+type Level struct {
+	Policy  BinMeasure
+	Packing string
+	// Profile is the name of the cluster profile of the level, "standard" if empty
+	Profile           string
+	Timeout           int32
+	BinCapacity       int32
+	MaxMemoryMB       int32
+	MaxVCores         int32
+	DefaultMemoryMB   int32
+	DefaultVCores     int32
+	AutoscalingFactor float32
+	ReuseClusters     bool
+	MaxJobsPerCluster int32
+	FairShare         FairShare
+	// AgingTimeout is the number of minutes after which a waiting job is promoted, 0 disables aging
+	AgingTimeout int32
+	AgingTarget  int32
+	// RiskThreshold is the predicted failure probability from which a job is risky, 0 disables failure-aware packing
+	RiskThreshold float32
+	// RiskIsolation is either "isolate" (the default) or "group"
+	RiskIsolation string
+	Limits        Limits
+}
+
+// Limits bound the clusters existing at the same time, deployments exceeding them wait in a queue.
+// Zero values mean no limit
+type Limits struct {
+	MaxClusters int32
+	// MaxNodes is the maximum number of primary and preemptible workers
+	MaxNodes int32
+	// MaxHourlySpend is the maximum cost in dollars of one hour of all the workers, according to their profiles
+	MaxHourlySpend float64
+}
+
+// FairShare is the configuration of the fair-share mode of a level
+type FairShare struct {
+	Enabled bool
+	// GroupBy is either "user" or "team"
+	GroupBy string
+	// Shares maps users (by ID) or teams (by name) to their weight
+	Shares map[string]float64
+	// DefaultShare is the weight of the users or teams not listed in Shares
+	DefaultShare float64
+	// UsageWindow is the number of seconds of history considered to compute the recent usage
+	UsageWindow int32
+	// JobsPerTimeout is the number of jobs admitted into the bins during each level timeout
+	JobsPerTimeout int32
+}
+
+// WarmPool is the configuration of the clusters created in advance for each profile
+type WarmPool struct {
+	TTL               int32
+	ReplenishInterval int32
+	AutoscalingFactor float32
+	// Clusters maps each profile to the number of idle clusters to keep
+	Clusters map[string]int
+}
+
+// Pool is the configuration of the liveliness monitoring of the clusters in the pool
+type Pool struct {
+	// KillTimeout is the number of seconds without heartbeats after which a cluster is considered lost
+	KillTimeout int16
+	// CheckInterval is the number of seconds between two liveliness checks
+	CheckInterval int
+}
+
+// Reconciler is the configuration of the routine aligning the pool and the database with the clusters
+// which actually exist on the platforms
+type Reconciler struct {
+	// Interval is the number of seconds between two reconciliations, 0 disables the periodic reconciliation
+	Interval int32
+	// GracePeriod is the number of seconds after their creation during which clusters missing from
+	// their platform are not reconciled, since they may still be being created
+	GracePeriod int32
+	// Orphans is the policy for the clusters recorded in the database but not in the pool: "adopt", "delete"
+	// or "alert"
+	Orphans string
+	// Unknown is the policy for the clusters not recorded in the database: "delete" or "alert"
+	Unknown string
+}
+
+// Webhooks is the configuration of the delivery of the webhook notifications
+type Webhooks struct {
+	// Timeout is the number of seconds to wait for the response of a webhook
+	Timeout int32
+	// MaxAttempts is the number of deliveries tried before giving up on a payload
+	MaxAttempts int32
+	// Backoff is the number of seconds before the first retry, doubled at each further attempt up to MaxBackoff
+	Backoff    int32
+	MaxBackoff int32
+}
+
+// Simulation describes how the simulated platform used by the simulator behaves, the resources and the costs
+// of the workers are the ones of the cluster profiles
+type Simulation struct {
+	// ProvisioningTime is the number of seconds needed to create a cluster
+	ProvisioningTime int32
+	// ContainerMemoryMB is the memory of each YARN container, every container takes one virtual core
+	ContainerMemoryMB int32
+	// DefaultJobContainers is the number of containers used by jobs without a predicted number of virtual cores
+	DefaultJobContainers int32
+}
+
+// Fake describes how the in-memory fake platform behaves. Its clusters run on the real clock and send heartbeats
+// to heartbeatHost:heartbeatPort like the real ones, the resources and the costs of their workers are the ones
+// of the cluster profiles
+type Fake struct {
+	// ProvisioningTime is the number of seconds needed to create a cluster
+	ProvisioningTime int32
+	// JobDuration is the number of seconds taken by the jobs without a predicted duration
+	JobDuration int32
+	// DurationScale multiplies the predicted durations of the jobs, e.g. 0.01 to run them a hundred times faster
+	DurationScale float64
+	// FailureRate is the probability of a job to fail
+	FailureRate float64
+	// HeartbeatInterval is the number of seconds between two heartbeats of a cluster
+	HeartbeatInterval int32
+	// ContainerMemoryMB is the memory of each YARN container, every container takes one virtual core
+	ContainerMemoryMB int32
+	// DefaultJobContainers is the number of containers used by jobs without a predicted number of virtual cores
+	DefaultJobContainers int32
+}
+
+// defaults are the values of the settings missing from the configuration file. Every scalar setting must
+// be listed here to be overridable through the environment
+var defaults = map[string]interface{}{
+	"projectId":                           "",
+	"region":                              "global",
+	"zone":                                "",
+	"dataproc-image":                      "",
+	"heartbeatHost":                       "",
+	"heartbeatPort":                       0,
+	"masterPort":                          8081,
+	"predictorHost":                       "",
+	"predictorPort":                       8080,
+	"autoscalingFactorOneJobOneCluster":   0.25,
+	"autoscalingFactorOneJobOneClusterHP": 0.3,
+	"clusterProvisioningTime":             120,
+	"profileOneJobOneCluster":             model.StandardProfile,
+	"profileOneJobOneClusterHP":           model.HighPerformanceProfile,
+	"defaultInfrastructure":               "default",
+	"warmPool.ttl":                        1800,
+	"warmPool.replenishInterval":          60,
+	"warmPool.autoscalingFactor":          0.2,
+	"pool.killTimeout":                    60,
+	"pool.checkInterval":                  30,
+	"reconciler.interval":                 300,
+	"reconciler.gracePeriod":              900,
+	"reconciler.orphans":                  model.ReconcileAdopt,
+	"reconciler.unknown":                  model.ReconcileDelete,
+	"webhooks.timeout":                    10,
+	"webhooks.maxAttempts":                8,
+	"webhooks.backoff":                    30,
+	"webhooks.maxBackoff":                 3600,
+	"simulation.provisioningTime":         120,
+	"simulation.containerMemoryMB":        2048,
+	"simulation.defaultJobContainers":     4,
+	"fake.provisioningTime":               10,
+	"fake.jobDuration":                    60,
+	"fake.durationScale":                  1.0,
+	"fake.failureRate":                    0.0,
+	"fake.heartbeatInterval":              5,
+	"fake.containerMemoryMB":              2048,
+	"fake.defaultJobContainers":           4,
+}
+
+// legacyEnv maps settings to the environment variables which were used to configure them before
+// the configuration file supported them, they are used as defaults
+var legacyEnv = map[string]string{
+	"heartbeatPort": "HEARTBEAT_SERVICE_NODEPORT",
+	"predictorHost": "PREDICTOR_SERVICE_DNS_NAME",
+}
+
+// PredictorAddress returns the address of the predictor service
+func (c *Config) PredictorAddress() string {
+	return fmt.Sprintf("%s:%d", c.PredictorHost, c.PredictorPort)
+}
+
+// ClusterProfile returns the cluster profile with the given name, either configured or built-in
+// @param name is the name of the profile, "standard" if empty
+func (c *Config) ClusterProfile(name string) (model.ClusterProfile, bool) {
+	if name == "" {
+		name = model.StandardProfile
+	}
+	if profile, ok := c.ClusterProfiles[name]; ok {
+		return profile, true
+	}
+	profile, ok := model.BuiltinProfiles()[name]
+	return profile, ok
+}
+
+// Infrastructure returns the infrastructure with the given name
+// @param name is the name of the infrastructure, the default one if empty
+func (c *Config) Infrastructure(name string) (Infrastructure, bool) {
+	if name == "" {
+		name = c.DefaultInfrastructure
+	}
+	infrastructure, ok := c.Infrastructures[name]
+	return infrastructure, ok
+}
+
+// InfrastructureNames returns the names of all the infrastructures
+func (c *Config) InfrastructureNames() []string {
+	var names []string
+	for name := range c.Infrastructures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeInfrastructures names the configured infrastructures, fills the settings they leave unspecified with
+// the global ones and adds the default infrastructure if it is not configured
+func (c *Config) completeInfrastructures() {
+	if c.Infrastructures == nil {
+		c.Infrastructures = make(map[string]Infrastructure)
+	}
+	if _, ok := c.Infrastructures[c.DefaultInfrastructure]; !ok {
+		c.Infrastructures[c.DefaultInfrastructure] = Infrastructure{}
+	}
+	for name, infrastructure := range c.Infrastructures {
+		infrastructure.Name = name
+		if infrastructure.Platform == "" {
+			infrastructure.Platform = "dataproc"
+		}
+		if infrastructure.ProjectID == "" {
+			infrastructure.ProjectID = c.ProjectID
+		}
+		if infrastructure.Region == "" {
+			infrastructure.Region = c.Region
+		}
+		if infrastructure.Zone == "" {
+			infrastructure.Zone = c.Zone
+		}
+		if len(infrastructure.SchedulingLevels) == 0 {
+			infrastructure.SchedulingLevels = c.SchedulingLevels
+			infrastructure.inheritedLevels = true
+		}
+		if infrastructure.Livy.Timeout == 0 {
+			infrastructure.Livy.Timeout = 30
+		}
+		if infrastructure.Livy.PollInterval == 0 {
+			infrastructure.Livy.PollInterval = 10
+		}
+		c.Infrastructures[name] = infrastructure
+	}
+}
+
+// completeProfiles names the configured profiles and fills the settings they leave unspecified
+func (c *Config) completeProfiles() {
+	for name, profile := range c.ClusterProfiles {
+		profile.Name = name
+		if profile.MasterMachineType == "" {
+			profile.MasterMachineType = profile.WorkerMachineType
+		}
+		if profile.PreemptibleMachineType == "" {
+			profile.PreemptibleMachineType = profile.WorkerMachineType
+		}
+		if profile.Autoscaling.Policy == "" {
+			profile.Autoscaling.Policy = "workload"
+		}
+		if profile.Autoscaling.Interval == 0 {
+			profile.Autoscaling.Interval = 60
+		}
+		c.ClusterProfiles[name] = profile
+	}
+}
+
+// current configuration of the process
+var current *Config
+var currentLock sync.RWMutex
+
+// Get returns the configuration loaded by the last successful call to Load
+func Get() *Config {
+	currentLock.RLock()
+	defer currentLock.RUnlock()
+	if current == nil {
+		return &Config{}
+	}
+	return current
+}
+
+// Set replaces the configuration of the process
+// @param c is the new configuration
+func Set(c *Config) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	current = c
+}
+
+// Load reads the configuration file, applying the defaults and the overrides. The loaded configuration
+// becomes the one of the process but it is not validated, Validate must be called before using it
+// @param path is the location of the configuration file
+// @param overrides are settings given as "key=value", taking precedence over the environment and the file
+func Load(path string, overrides []string) (*Config, error) {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+	for key, env := range legacyEnv {
+		if value, ok := os.LookupEnv(env); ok {
+			v.SetDefault(key, value)
+		}
+	}
+
+	if path != "" {
+		dir, filename := filepath.Split(path)
+		ext := filepath.Ext(filename)
+		v.AddConfigPath(dir)
+		v.SetConfigName(filename[0 : len(filename)-len(ext)])
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("unable to read configuration: %s", err)
+		}
+	}
+
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid override '%s', expected key=value", override)
+		}
+		v.Set(kv[0], kv[1])
+	}
+
+	c := &Config{}
+	if err := v.Unmarshal(c); err != nil {
+		return nil, fmt.Errorf("unable to decode configuration: %s", err)
+	}
+	c.completeProfiles()
+	c.completeInfrastructures()
+	Set(c)
+
+	return c, nil
+}
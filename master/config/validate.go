@@ -0,0 +1,286 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"obi/master/model"
+)
+
+// Validator checks the parts of the configuration owned by a package
+type Validator func(c *Config) []error
+
+// validators registered by the packages which define the meaning of some settings
+var validators []Validator
+
+// AddValidator registers a new check performed by Validate, it is meant to be called at package initialization
+// @param v is the check to add
+func AddValidator(v Validator) {
+	validators = append(validators, v)
+}
+
+// Validate checks the whole configuration
+// return every error found, nil if the configuration is valid
+func (c *Config) Validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.MasterPort <= 0 || c.MasterPort > 65535 {
+		fail("masterPort: %d is not a valid port", c.MasterPort)
+	}
+	if c.PredictorPort <= 0 || c.PredictorPort > 65535 {
+		fail("predictorPort: %d is not a valid port", c.PredictorPort)
+	}
+	if c.HeartbeatPort < 0 || c.HeartbeatPort > 65535 {
+		fail("heartbeatPort: %d is not a valid port", c.HeartbeatPort)
+	}
+	if c.AutoscalingFactorOneJobOneCluster < 0 {
+		fail("autoscalingFactorOneJobOneCluster: must not be negative")
+	}
+	if c.AutoscalingFactorOneJobOneClusterHP < 0 {
+		fail("autoscalingFactorOneJobOneClusterHP: must not be negative")
+	}
+	if c.ClusterProvisioningTime < 0 {
+		fail("clusterProvisioningTime: must not be negative")
+	}
+
+	// Levels beyond the configured ones deploy each job on its own cluster
+	maxPriority := int32(len(c.SchedulingLevels)) + 1
+	for i, level := range c.SchedulingLevels {
+		errs = append(errs, level.validate(i, maxPriority)...)
+	}
+	for _, name := range c.InfrastructureNames() {
+		errs = append(errs, c.Infrastructures[name].validate(c)...)
+	}
+	if c.DefaultInfrastructure == "" {
+		fail("defaultInfrastructure: required")
+	}
+	for label, priority := range c.PriorityMap {
+		if priority < 0 || priority > maxPriority {
+			fail("priorityMap.%s: level %d does not exist, it must be between 0 and %d", label, priority, maxPriority)
+		}
+	}
+
+	for name, profile := range c.ClusterProfiles {
+		errs = append(errs, validateProfile(name, &profile)...)
+	}
+	for i, level := range c.SchedulingLevels {
+		if _, ok := c.ClusterProfile(level.Profile); !ok {
+			fail("schedulingLevels[%d].profile: unknown cluster profile '%s'", i, level.Profile)
+		}
+	}
+	if _, ok := c.ClusterProfile(c.ProfileOneJobOneCluster); !ok {
+		fail("profileOneJobOneCluster: unknown cluster profile '%s'", c.ProfileOneJobOneCluster)
+	}
+	if _, ok := c.ClusterProfile(c.ProfileOneJobOneClusterHP); !ok {
+		fail("profileOneJobOneClusterHP: unknown cluster profile '%s'", c.ProfileOneJobOneClusterHP)
+	}
+	for profile := range c.WarmPool.Clusters {
+		if _, ok := c.ClusterProfile(profile); !ok {
+			fail("warmPool.clusters.%s: unknown cluster profile", profile)
+		}
+	}
+
+	errs = append(errs, c.WarmPool.validate()...)
+	errs = append(errs, c.Limits.validate("limits")...)
+	if c.Pool.KillTimeout <= 0 || c.Pool.CheckInterval <= 0 {
+		fail("pool: killTimeout and checkInterval must be positive")
+	}
+	errs = append(errs, c.Reconciler.validate()...)
+	if c.Webhooks.Timeout <= 0 || c.Webhooks.MaxAttempts <= 0 {
+		fail("webhooks: timeout and maxAttempts must be positive")
+	}
+	if c.Webhooks.Backoff < 0 || c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+		fail("webhooks: backoff must not be negative nor greater than maxBackoff")
+	}
+	errs = append(errs, c.Fake.validate()...)
+
+	for _, v := range validators {
+		errs = append(errs, v(c)...)
+	}
+	return errs
+}
+
+func (l *Level) validate(i int, maxPriority int32) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("schedulingLevels[%d].%s", i, fmt.Sprintf(format, args...)))
+	}
+
+	if _, ok := BinMeasureNames[l.Policy]; !ok {
+		fail("policy: unknown bin measure %d", l.Policy)
+	}
+	if l.Timeout <= 0 {
+		fail("timeout: must be positive")
+	}
+	if l.Policy == MeasureResources {
+		if l.BinCapacity <= 0 && l.MaxMemoryMB <= 0 && l.MaxVCores <= 0 {
+			fail("binCapacity: at least one of binCapacity, maxMemoryMB and maxVCores must be positive")
+		}
+	} else if l.BinCapacity <= 0 {
+		fail("binCapacity: must be positive")
+	}
+	if l.MaxMemoryMB < 0 || l.MaxVCores < 0 || l.DefaultMemoryMB < 0 || l.DefaultVCores < 0 {
+		fail("resources: memory and vcores must not be negative")
+	}
+	if l.AutoscalingFactor < 0 {
+		fail("autoscalingFactor: must not be negative")
+	}
+	if l.MaxJobsPerCluster < 0 {
+		fail("maxJobsPerCluster: must not be negative")
+	}
+	if l.AgingTimeout < 0 {
+		fail("agingTimeout: must not be negative")
+	}
+	if l.AgingTimeout > 0 && (l.AgingTarget < 0 || l.AgingTarget > maxPriority) {
+		fail("agingTarget: level %d does not exist, it must be between 0 and %d", l.AgingTarget, maxPriority)
+	}
+	for _, err := range l.Limits.validate("limits") {
+		fail("%s", err)
+	}
+	if l.RiskThreshold < 0 || l.RiskThreshold > 1 {
+		fail("riskThreshold: %g is not a probability", l.RiskThreshold)
+	}
+	if l.RiskIsolation != "" && l.RiskIsolation != model.RiskIsolate && l.RiskIsolation != model.RiskGroup {
+		fail("riskIsolation: '%s' must be either '%s' or '%s'", l.RiskIsolation, model.RiskIsolate, model.RiskGroup)
+	}
+
+	fs := l.FairShare
+	if fs.GroupBy != "" && fs.GroupBy != "user" && fs.GroupBy != "team" {
+		fail("fairShare.groupBy: '%s' must be either 'user' or 'team'", fs.GroupBy)
+	}
+	if fs.DefaultShare < 0 || fs.UsageWindow < 0 || fs.JobsPerTimeout < 0 {
+		fail("fairShare: defaultShare, usageWindow and jobsPerTimeout must not be negative")
+	}
+	for owner, share := range fs.Shares {
+		if share < 0 {
+			fail("fairShare.shares.%s: must not be negative", owner)
+		}
+	}
+	return errs
+}
+
+func (i Infrastructure) validate(c *Config) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("infrastructures.%s.%s", i.Name, fmt.Sprintf(format, args...)))
+	}
+
+	// The levels inherited from the global ones are already validated
+	if i.inheritedLevels {
+		return errs
+	}
+	maxPriority := int32(len(i.SchedulingLevels)) + 1
+	for j, level := range i.SchedulingLevels {
+		for _, err := range level.validate(j, maxPriority) {
+			fail("%s", err)
+		}
+		if _, ok := c.ClusterProfile(level.Profile); !ok {
+			fail("schedulingLevels[%d].profile: unknown cluster profile '%s'", j, level.Profile)
+		}
+	}
+	return errs
+}
+
+func validateProfile(name string, p *model.ClusterProfile) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("clusterProfiles.%s.%s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if p.WorkerMachineType == "" {
+		fail("workerMachineType: required")
+	}
+	if p.WorkerNodes < 2 {
+		fail("workerNodes: at least 2 primary workers are required")
+	}
+	if p.PreemptibleNodes < 0 || p.MinPreemptibleNodes < 0 {
+		fail("preemptibleNodes: must not be negative")
+	}
+	if p.DiskSizeGB < 0 {
+		fail("diskSizeGB: must not be negative")
+	}
+	if p.NodeMemoryMB <= 0 || p.NodeVCores <= 0 {
+		fail("nodeMemoryMB: the resources of a worker must be positive")
+	}
+	if p.NodeCostPerHour < 0 || p.PreemptibleNodeCostPerHour < 0 || p.PlatformCostPerHour < 0 {
+		fail("nodeCostPerHour: costs must not be negative")
+	}
+	if p.Autoscaling.Factor < 0 || p.Autoscaling.Interval < 0 || p.Autoscaling.MaxAbsDelta < 0 {
+		fail("autoscaling: factor, interval and maxAbsDelta must not be negative")
+	}
+	if p.Lifecycle.IdleTimeout < 0 || p.Lifecycle.MaxLifetime < 0 {
+		fail("lifecycle: idleTimeout and maxLifetime must not be negative")
+	}
+	return errs
+}
+
+func (l *Limits) validate(prefix string) []error {
+	if l.MaxClusters < 0 || l.MaxNodes < 0 || l.MaxHourlySpend < 0 {
+		return []error{fmt.Errorf("%s: maxClusters, maxNodes and maxHourlySpend must not be negative", prefix)}
+	}
+	return nil
+}
+
+func (r *Reconciler) validate() []error {
+	var errs []error
+	if r.Interval < 0 || r.GracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("reconciler: interval and gracePeriod must not be negative"))
+	}
+	if r.Orphans != model.ReconcileAdopt && r.Orphans != model.ReconcileDelete && r.Orphans != model.ReconcileAlert {
+		errs = append(errs, fmt.Errorf("reconciler.orphans: '%s' must be one of '%s', '%s' and '%s'", r.Orphans,
+			model.ReconcileAdopt, model.ReconcileDelete, model.ReconcileAlert))
+	}
+	if r.Unknown != model.ReconcileDelete && r.Unknown != model.ReconcileAlert {
+		errs = append(errs, fmt.Errorf("reconciler.unknown: '%s' must be either '%s' or '%s'", r.Unknown,
+			model.ReconcileDelete, model.ReconcileAlert))
+	}
+	return errs
+}
+
+func (w *WarmPool) validate() []error {
+	var errs []error
+	if len(w.Clusters) == 0 {
+		return nil
+	}
+	if w.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("warmPool.ttl: must be positive"))
+	}
+	if w.ReplenishInterval <= 0 {
+		errs = append(errs, fmt.Errorf("warmPool.replenishInterval: must be positive"))
+	}
+	for profile, size := range w.Clusters {
+		if size < 0 {
+			errs = append(errs, fmt.Errorf("warmPool.clusters.%s: must not be negative", profile))
+		}
+	}
+	return errs
+}
+
+func (f *Fake) validate() []error {
+	var errs []error
+	if f.ProvisioningTime < 0 || f.JobDuration < 0 || f.DurationScale < 0 {
+		errs = append(errs, fmt.Errorf("fake: provisioningTime, jobDuration and durationScale must not be negative"))
+	}
+	if f.FailureRate < 0 || f.FailureRate > 1 {
+		errs = append(errs, fmt.Errorf("fake.failureRate: %g is not a probability", f.FailureRate))
+	}
+	if f.HeartbeatInterval <= 0 || f.ContainerMemoryMB <= 0 || f.DefaultJobContainers <= 0 {
+		errs = append(errs, fmt.Errorf("fake: heartbeatInterval, containerMemoryMB and defaultJobContainers must be positive"))
+	}
+	return errs
+}
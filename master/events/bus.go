@@ -0,0 +1,317 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package events
+
+import (
+	"obi/master/model"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// Type identifies a kind of state change
+type Type string
+
+// Types of the events published on the bus
+const (
+	JobSubmitted       Type = "job-submitted"
+	JobScheduled       Type = "job-scheduled"
+	JobStarted         Type = "job-started"
+	JobFinished        Type = "job-finished"
+	ClusterCreating    Type = "cluster-creating"
+	ClusterRunning     Type = "cluster-running"
+	ClusterScaled      Type = "cluster-scaled"
+	ClusterDeleted     Type = "cluster-deleted"
+	AutoscalerDecision Type = "autoscaler-decision"
+	BinFlushed         Type = "bin-flushed"
+)
+
+// Types lists all the types of events
+var Types = []Type{
+	JobSubmitted,
+	JobScheduled,
+	JobStarted,
+	JobFinished,
+	ClusterCreating,
+	ClusterRunning,
+	ClusterScaled,
+	ClusterDeleted,
+	AutoscalerDecision,
+	BinFlushed,
+}
+
+// subscriberBuffer is the number of events kept for each lossy subscriber which is not reading fast enough
+const subscriberBuffer = 256
+
+// Event is a state change of a job or of a cluster
+type Event struct {
+	Type      Type
+	Timestamp time.Time
+	// JobID is the job the event is about, 0 for the cluster events
+	JobID int
+	// ClusterName is the cluster the event is about, or the one hosting the job
+	ClusterName string
+	// Infrastructure is the infrastructure of the scheduler which flushed the bin
+	Infrastructure string
+	Level          int32
+	Profile     string
+	// Status is the status of the job or of the cluster after the change
+	Status string
+	// Size of the cluster after the change
+	WorkerNodes      int32
+	PreemptibleNodes int32
+	// Delta is the number of nodes the autoscaler asked to add, negative to remove them
+	Delta int32
+	// Applied tells whether the autoscaler decision was carried out
+	Applied bool
+	// Reused tells whether the jobs of the flushed bin were deployed on a running cluster
+	Reused bool
+	// Queued tells whether the deployment of the flushed bin is waiting for the cluster limits
+	Queued bool
+	// Reason is why the bin was flushed
+	Reason string
+	// Jobs concerned by the event: the job itself, or the ones hosted by the cluster
+	Jobs []*model.Job
+}
+
+// Filter selects the events delivered to a subscriber, its empty fields match any event
+type Filter struct {
+	Types          []Type
+	JobID          int
+	ClusterName    string
+	Infrastructure string
+}
+
+// Matches checks whether the event is selected by the filter
+func (f *Filter) Matches(e *Event) bool {
+	if f.JobID != 0 && f.JobID != e.JobID {
+		return false
+	}
+	if f.ClusterName != "" && f.ClusterName != e.ClusterName {
+		return false
+	}
+	if f.Infrastructure != "" && f.Infrastructure != e.Infrastructure {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriber receives the events selected by its filter
+type subscriber struct {
+	filter Filter
+	// send hands the event to the subscriber, it must not block
+	send func(e Event)
+}
+
+// subscribers holds the listeners of the events
+var subscribers = struct {
+	list map[*subscriber]struct{}
+	sync.Mutex
+}{list: make(map[*subscriber]struct{})}
+
+// add registers a subscriber
+// return the function removing it, to be called holding no lock of the bus
+func add(sub *subscriber) func() {
+	subscribers.Lock()
+	subscribers.list[sub] = struct{}{}
+	subscribers.Unlock()
+	return func() {
+		subscribers.Lock()
+		delete(subscribers.list, sub)
+		subscribers.Unlock()
+	}
+}
+
+// Subscribe registers a new listener of the events selected by the filter. Events are dropped for the
+// listener if it is not reading fast enough
+// @param filter selects the events to deliver
+// return the channel on which the events are delivered and the function to call to unsubscribe
+func Subscribe(filter Filter) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	remove := add(&subscriber{filter, func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	}})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			remove()
+			close(ch)
+		})
+	}
+}
+
+// SubscribeReliable registers a new listener of the events selected by the filter which never loses any of
+// them: the events the listener is not reading yet are kept in memory, in the order they were published,
+// without slowing down the publishers
+// @param filter selects the events to deliver
+// return the channel on which the events are delivered and the function to call to unsubscribe
+func SubscribeReliable(filter Filter) (<-chan Event, func()) {
+	ch := make(chan Event)
+	var pending struct {
+		events []Event
+		sync.Mutex
+	}
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	remove := add(&subscriber{filter, func(e Event) {
+		pending.Lock()
+		pending.events = append(pending.events, e)
+		pending.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}})
+
+	// Hand the pending events to the listener one at a time
+	go func() {
+		defer close(ch)
+		for {
+			pending.Lock()
+			if len(pending.events) == 0 {
+				pending.Unlock()
+				select {
+				case <-wake:
+					continue
+				case <-done:
+					return
+				}
+			}
+			e := pending.events[0]
+			pending.events = pending.events[1:]
+			pending.Unlock()
+
+			select {
+			case ch <- e:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			remove()
+			close(done)
+		})
+	}
+}
+
+// Publish delivers the event to the subscribers whose filter selects it, without ever blocking
+// @param e is the event, its timestamp is set to the current time if missing
+func Publish(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = utils.Now()
+	}
+
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	for sub := range subscribers.list {
+		if sub.filter.Matches(&e) {
+			sub.send(e)
+		}
+	}
+}
+
+// PublishJob publishes an event about a job
+// @param t is the type of the event
+// @param job is the job whose state changed
+func PublishJob(t Type, job *model.Job) {
+	e := Event{
+		Type:    t,
+		JobID:   job.ID,
+		Level:   job.Priority,
+		Profile: job.Profile,
+		Status:  model.JobStatusNames[job.Status],
+		Jobs:    []*model.Job{job},
+	}
+	if job.Cluster != nil {
+		e.ClusterName = job.Cluster.GetName()
+	}
+	Publish(e)
+}
+
+// PublishCluster publishes an event about a cluster
+// @param t is the type of the event
+// @param cluster is the cluster whose state changed
+func PublishCluster(t Type, cluster model.ClusterBaseInterface) {
+	Publish(Event{
+		Type:             t,
+		ClusterName:      cluster.GetName(),
+		Level:            cluster.GetSchedulingLevel(),
+		Profile:          cluster.GetProfile(),
+		Status:           model.ClusterStatusNames[cluster.GetStatus()],
+		WorkerNodes:      cluster.GetWorkerNodes(),
+		PreemptibleNodes: cluster.GetPreemptibleNodes(),
+		Jobs:             cluster.GetJobs(),
+	})
+}
+
+// PublishDecision publishes the decision taken by the autoscaler of a cluster
+// @param cluster is the cluster managed by the autoscaler
+// @param delta is the number of nodes the policy asked to add, negative to remove them
+// @param applied tells whether the cluster was scaled accordingly
+func PublishDecision(cluster model.ClusterBaseInterface, delta int32, applied bool) {
+	Publish(Event{
+		Type:             AutoscalerDecision,
+		ClusterName:      cluster.GetName(),
+		Level:            cluster.GetSchedulingLevel(),
+		Profile:          cluster.GetProfile(),
+		WorkerNodes:      cluster.GetWorkerNodes(),
+		PreemptibleNodes: cluster.GetPreemptibleNodes(),
+		Delta:            delta,
+		Applied:          applied,
+	})
+}
+
+// PublishFlush publishes the deployment of the jobs of a bin flushed by the scheduler
+// @param infrastructure is the infrastructure of the scheduler
+// @param level is the scheduling level of the bin
+// @param jobs are the jobs of the bin
+// @param cluster is the cluster hosting the jobs, nil if the deployment failed or was queued
+// @param reused tells whether the cluster was already running
+// @param queued tells whether the deployment is waiting for the cluster limits
+// @param reason is why the bin was flushed
+func PublishFlush(infrastructure string, level int32, jobs []*model.Job, cluster model.ClusterBaseInterface,
+	reused, queued bool, reason string) {
+	e := Event{
+		Type:           BinFlushed,
+		Infrastructure: infrastructure,
+		Level:          level,
+		Reused:         reused,
+		Queued:         queued,
+		Reason:         reason,
+		Jobs:           jobs,
+	}
+	if cluster != nil {
+		e.ClusterName = cluster.GetName()
+		e.Profile = cluster.GetProfile()
+	}
+	Publish(e)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReliableSubscriptionUnderBurst(t *testing.T) {
+	const burst = 10 * subscriberBuffer
+	reliable, stopReliable := SubscribeReliable(Filter{Types: []Type{JobFinished}})
+	defer stopReliable()
+	lossy, stopLossy := Subscribe(Filter{Types: []Type{JobFinished}})
+	defer stopLossy()
+
+	// Nobody reads while the burst is published, which must not block the publisher
+	published := make(chan struct{})
+	go func() {
+		for i := 1; i <= burst; i++ {
+			Publish(Event{Type: JobFinished, JobID: i})
+		}
+		Publish(Event{Type: JobStarted, JobID: burst + 1})
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publishing blocked on the subscribers")
+	}
+
+	for i := 1; i <= burst; i++ {
+		select {
+		case e := <-reliable:
+			if e.JobID != i {
+				t.Fatalf("got event of job %d, want job %d", e.JobID, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d of %d lost", i, burst)
+		}
+	}
+	select {
+	case e := <-reliable:
+		t.Errorf("got event %s of job %d not selected by the filter", e.Type, e.JobID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if n := len(lossy); n != subscriberBuffer {
+		t.Errorf("lossy subscriber kept %d events, want %d", n, subscriberBuffer)
+	}
+}
+
+func TestUnsubscribeReliable(t *testing.T) {
+	ch, stop := SubscribeReliable(Filter{})
+	Publish(Event{Type: JobSubmitted, JobID: 1})
+	stop()
+	stop()
+	// Publishing after the subscription ended must not reach it
+	Publish(Event{Type: JobSubmitted, JobID: 2})
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.JobID != 1 {
+				t.Errorf("got event of job %d after unsubscribing", e.JobID)
+			}
+		case <-timeout:
+			t.Fatal("channel not closed after unsubscribing")
+		}
+	}
+}
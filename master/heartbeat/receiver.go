@@ -20,10 +20,7 @@ import (
 	"net"
 			"obi/master/model"
 		"obi/master/pool"
-	"obi/master/persistent"
-	"obi/master/platforms"
-	"obi/master/autoscaler/policies"
-	"obi/master/autoscaler"
+	"sync"
 )
 
 // Receiver is the heartbeat module in charge of updating clusters metrics.
@@ -31,54 +28,73 @@ import (
 // If it receives an heartbeat from a cluster not in the pool, it creates the instance
 // for that cluster in order to monitor it.
 type Receiver struct {
+	pool *pool.Pool
+	port int
+	// channel to interrupt the heartbeat receiver routine
+	quit chan struct{}
+	// UDP connection
+	conn *net.UDPConn
+	// reconciling holds the names of the clusters being reconciled, so that their heartbeats do not start
+	// another reconciliation meanwhile
+	reconciling sync.Map
 }
 
-// channel to interrupt the heartbeat receiver routine
-var quit chan struct{}
+// Option customizes a Receiver created with New
+type Option func(*Receiver)
 
-// UDP connection
-var conn *net.UDPConn
+// WithPort sets the UDP port on which the heartbeats are received
+// @param port is the port to listen on, 8080 by default
+func WithPort(port int) Option {
+	return func(r *Receiver) {
+		r.port = port
+	}
+}
 
 // New is the constructor of the heartbeat Receiver struct
-// @param pool contains the clusters to update regularly
+// @param p contains the clusters to update regularly
+// @param options customize the receiver
 // return the pointer to the instance
-func New() *Receiver {
-	r := &Receiver{}
+func New(p *pool.Pool, options ...Option) *Receiver {
+	r := &Receiver{pool: p, port: 8080}
+	for _, option := range options {
+		option(r)
+	}
 
 	return r
 }
 
 // Start the execution of the heartbeat receiver
 func (receiver *Receiver) Start() {
-	quit = make(chan struct{})
-	logrus.Info("Starting heartbeat receiver routine.")
-	go receiverRoutine(pool.GetPool())
-}
-
-// goroutine which listens to new heartbeats from cluster masters. It will be stop when an empty object is inserted in
-// the `quit` channel
-// @param pool contains the available clusters to update with new metrics
-func receiverRoutine(pool *pool.Pool) {
-	var err error
+	receiver.quit = make(chan struct{})
 
 	// listen to incoming udp packets
 	addr := net.UDPAddr{
-		Port: 8080,
+		Port: receiver.port,
 		IP:   net.ParseIP("0.0.0.0"),
 	}
 
-	conn, err = net.ListenUDP("udp", &addr)
+	var err error
+	receiver.conn, err = net.ListenUDP("udp", &addr)
 	if err != nil {
 		logrus.WithField("error", err).Error("'ListenUDP' method call for creating new UDP server failed")
 		return
 	}
 
+	logrus.Info("Starting heartbeat receiver routine.")
+	go receiverRoutine(receiver)
+}
+
+// goroutine which listens to new heartbeats from cluster masters. It will be stop when an empty object is inserted in
+// the `quit` channel
+// @param receiver contains the connection to listen on and the pool of the clusters to update with new metrics
+func receiverRoutine(receiver *Receiver) {
+	pool := receiver.pool
 	for {
 		data := make([]byte, 4096)
-		n, err:= conn.Read(data)
+		n, err:= receiver.conn.Read(data)
 		if err != nil {
 			select {
-			case <-quit:
+			case <-receiver.quit:
 				logrus.Info("Closing heartbeat receiver routine.")
 				// the error was caused by the closing of the listener
 				return
@@ -104,29 +120,13 @@ func receiverRoutine(pool *pool.Pool) {
 		} else {
 			logrus.WithField("clusterName", m.GetClusterName()).Info("Received metrics for a cluster not in the pool.")
 
-			clusterExists, err := persistent.ClusterExists(m.GetClusterName())
-			if err != nil {
-				continue
-			}
-
-			newCluster, err := platforms.NewExistingCluster("dataproc", m.GetClusterName())
-			if err != nil {
-				logrus.WithField("Error", err).Error("Existing cluster not inserted in the pool")
-				continue
-
-			}
-
-			if clusterExists {
-				policy :=  policies.NewWorkload(0.2)
-				a := autoscaler.New(policy, 60, newCluster.(model.Scalable), false, 0)
-
-				pool.AddCluster(newCluster, a)
-
-				a.StartMonitoring()
-
-				logrus.WithField("clusterName", m.GetClusterName()).Info("Added cluster in the pool")
-			} else {
-				newCluster.FreeResources()
+			// Adopt, delete or report the cluster according to the reconciliation policies, without holding up
+			// the heartbeats of the other clusters while the platform is queried
+			if _, busy := receiver.reconciling.LoadOrStore(m.GetClusterName(), true); !busy {
+				go func(clusterName string) {
+					defer receiver.reconciling.Delete(clusterName)
+					pool.ReconcileCluster(clusterName)
+				}(m.GetClusterName())
 			}
 		}
 	}
@@ -134,6 +134,8 @@ func receiverRoutine(pool *pool.Pool) {
 
 // Stop the execution of the receiver goroutines
 func (receiver *Receiver) Stop() {
-	close(quit)
-	conn.Close()
+	close(receiver.quit)
+	if receiver.conn != nil {
+		receiver.conn.Close()
+	}
 }
@@ -0,0 +1,148 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package heartbeat
+
+import (
+	"net"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/platforms"
+	"obi/master/pool"
+	"testing"
+	"time"
+)
+
+// eventually polls the condition until it holds or the timeout expires
+func eventually(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// freeUDPPort returns a local UDP port nobody listens on
+func freeUDPPort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("no free UDP port: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestFakeClusterLifecycle(t *testing.T) {
+	port := freeUDPPort(t)
+	profile := model.BuiltinProfiles()[model.StandardProfile]
+	profile.Lifecycle.IdleTimeout = 0
+	infra := config.Infrastructure{Name: "local", Platform: "fake"}
+	config.Set(&config.Config{
+		HeartbeatHost:         "127.0.0.1",
+		HeartbeatPort:         port,
+		ClusterProfiles:       map[string]model.ClusterProfile{profile.Name: profile},
+		Infrastructures:       map[string]config.Infrastructure{infra.Name: infra},
+		DefaultInfrastructure: infra.Name,
+	})
+	defer config.Set(nil)
+
+	fake := platforms.Fake
+	defer func() {
+		platforms.Fake = fake
+	}()
+	platforms.Fake = platforms.FakeConfig{
+		Fake: config.Fake{
+			HeartbeatInterval:    1,
+			ContainerMemoryMB:    2048,
+			DefaultJobContainers: 2,
+		},
+		Duration: func(job *model.Job) time.Duration {
+			return 500 * time.Millisecond
+		},
+		Fails: func(job *model.Job) bool {
+			return false
+		},
+	}
+
+	p := pool.New()
+	receiver := New(p, WithPort(port))
+	receiver.Start()
+	defer receiver.Stop()
+
+	// Deploy a bin of two jobs on a new cluster
+	jobs := []*model.Job{{ID: 1}, {ID: 2}}
+	demand := model.ResourceDemand{MemoryMB: 8192, VCores: 4}
+	cluster, err := pool.NewSubmitter(p, infra).DeployJobs(jobs, 0, profile, 0, demand)
+	if err != nil {
+		t.Fatalf("deployment failed: %v", err)
+	}
+	if cluster.GetPlatform() != "fake" || cluster.GetAllocatedJobSlots() != 2 {
+		t.Fatalf("cluster of the bin: got platform %q with %d jobs", cluster.GetPlatform(),
+			cluster.GetAllocatedJobSlots())
+	}
+
+	// The heartbeats are only recorded by the receiver, since the cluster sends them over UDP
+	eventually(t, 10*time.Second, "a heartbeat", func() bool {
+		return cluster.GetMetricsWindow().Len() > 0
+	})
+	heartbeat, _ := model.LastMetrics(cluster.GetMetricsWindow())
+	if heartbeat.ClusterName != cluster.GetName() {
+		t.Errorf("heartbeat of cluster %q recorded for %q", heartbeat.ClusterName, cluster.GetName())
+	}
+	if heartbeat.NumberOfNodes != cluster.GetWorkerNodes()+cluster.GetPreemptibleNodes() {
+		t.Errorf("nodes in the heartbeat: got %d, want %d", heartbeat.NumberOfNodes,
+			cluster.GetWorkerNodes()+cluster.GetPreemptibleNodes())
+	}
+
+	// Once its jobs ended the idle cluster is released
+	eventually(t, 10*time.Second, "the end of the jobs", func() bool {
+		return cluster.GetAllocatedJobSlots() == 0
+	})
+	eventually(t, 10*time.Second, "the release of the cluster", func() bool {
+		p.EnforceLifecycle()
+		p.WaitReleases()
+		return cluster.GetStatus() == model.ClusterStatusClosed
+	})
+	for _, job := range jobs {
+		if job.Status != model.JobStatusCompleted {
+			t.Errorf("job %d: got status %s, want completed", job.ID, model.JobStatusNames[job.Status])
+		}
+	}
+	names, _ := platforms.ListFakeClusters()
+	for _, name := range names {
+		if name == cluster.GetName() {
+			t.Errorf("released cluster %q still listed by the fake platform", name)
+		}
+	}
+}
+
+func TestReceiversAreIndependent(t *testing.T) {
+	first := New(pool.New(), WithPort(freeUDPPort(t)))
+	second := New(pool.New(), WithPort(freeUDPPort(t)))
+	first.Start()
+	second.Start()
+	defer second.Stop()
+
+	first.Stop()
+	select {
+	case <-second.quit:
+		t.Error("stopping a receiver stopped another one")
+	default:
+	}
+	if err := second.conn.SetReadDeadline(time.Time{}); err != nil {
+		t.Errorf("stopping a receiver closed the socket of another one: %v", err)
+	}
+}
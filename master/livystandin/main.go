@@ -0,0 +1,49 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+// The Livy stand-in serves the stub of the Livy and of the YARN ResourceManager REST APIs used by the "livy"
+// platform, so that the master can run against it locally without a YARN cluster.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"obi/master/platforms/livystub"
+	"time"
+)
+
+func main() {
+	port := flag.Int("port", 8998, "port serving both the Livy and the ResourceManager endpoints")
+	duration := flag.Duration("duration", 30*time.Second, "time taken by every batch")
+	failRate := flag.Float64("fail-rate", 0, "probability of a batch to fail")
+	containers := flag.Int("containers", 4, "containers taken by every running batch")
+	nodes := flag.Int("nodes", 4, "nodes of the YARN cluster")
+	nodeMB := flag.Int("node-memory-mb", 12288, "memory of each node")
+	nodeVCores := flag.Int("node-vcores", 4, "virtual cores of each node")
+	flag.Parse()
+
+	s := livystub.New(livystub.Options{
+		Duration:   *duration,
+		FailRate:   *failRate,
+		Containers: int32(*containers),
+		Nodes:      int32(*nodes),
+		NodeMB:     int32(*nodeMB),
+		NodeVCores: int32(*nodeVCores),
+	})
+
+	logrus.WithField("port", *port).Info("Serving Livy stand-in")
+	logrus.Fatalln(http.ListenAndServe(fmt.Sprintf(":%d", *port), s.Handler()))
+}
@@ -20,8 +20,9 @@ import (
 	"net"
 	"fmt"
 	"google.golang.org/grpc"
-	"github.com/spf13/viper"
-	"path/filepath"
+	"flag"
+	"obi/master/config"
+	"strings"
 	"context"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -32,20 +33,74 @@ import (
 )
 
 
-func parseConfig() {
-	configPath := os.Getenv("CONFIG_PATH")
-	dir, filename := filepath.Split(configPath)
-	ext := filepath.Ext(filename)
-	name := filename[0:len(filename)-len(ext)]
+// overrides is the list of settings given on the command line as key=value
+type overrides []string
+
+func (o *overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+func init() {
+	config.AddValidator(func(c *config.Config) []error {
+		var errs []error
+		required := map[string]string{
+			"heartbeatHost": c.HeartbeatHost,
+			"predictorHost": c.PredictorHost,
+		}
+		for key, value := range required {
+			if value == "" {
+				errs = append(errs, fmt.Errorf("%s: required by the master", key))
+			}
+		}
+		if c.HeartbeatPort == 0 {
+			errs = append(errs, fmt.Errorf("heartbeatPort: required by the master"))
+		}
+		return errs
+	})
+}
+
+func parseConfig() *config.Config {
+	var settings overrides
+	configPath := flag.String("config", os.Getenv("CONFIG_PATH"), "path of the configuration file")
+	checkOnly := flag.Bool("check-config", false, "validate the configuration, print every error and exit")
+	flag.Var(&settings, "set", "override a setting of the configuration file, as key=value (repeatable)")
+	flag.Parse()
 
 	logrus.Info("Reading configuration")
 
-	viper.AddConfigPath(dir)
-	viper.SetConfigName(name)
-	err := viper.ReadInConfig()
+	c, err := config.Load(*configPath, settings)
 	if err != nil {
+		if *checkOnly {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		logrus.WithField("err", err).Fatalln("Unable to read configuration")
 	}
+
+	errs := c.Validate()
+	if *checkOnly {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+	for _, err := range errs {
+		logrus.WithField("err", err).Error("Invalid configuration")
+	}
+	if len(errs) > 0 {
+		logrus.Fatalln("Unable to start with an invalid configuration")
+	}
+
+	return c
 }
 
 func streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
@@ -85,14 +140,14 @@ func main() {
 	logrus.SetOutput(os.Stdout)
 
 	// Read configuration file
-	parseConfig()
+	c := parseConfig()
 
 	// Create ObiMaster instance
-	master := CreateMaster()
+	master := CreateMaster(c)
 
 	// Open connection
-	port := viper.GetString("masterPort")
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	port := c.MasterPort
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		logrus.WithField("error", err).Fatalln("Unable to open server listener")
 	}
@@ -18,29 +18,37 @@ import (
 	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"io"
+	"obi/master/config"
+	"obi/master/events"
 	"obi/master/heartbeat"
 	"obi/master/model"
 	"obi/master/persistent"
+	"obi/master/platforms"
 	"obi/master/pool"
 	"obi/master/predictor"
 	"obi/master/scheduling"
 	"obi/master/utils"
+	"obi/master/webhooks"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // ObiMaster structure representing one master instance for OBI
 type ObiMaster struct {
-	scheduler *scheduling.Scheduler
+	// schedulers maps the name of each infrastructure to the scheduler of its jobs
+	schedulers map[string]*scheduling.Scheduler
 	heartbeatReceiver *heartbeat.Receiver
+	notifier *webhooks.Notifier
 	predictorClient *predictor.ObiPredictorClient
-	priorities map[string]int
+	priorities map[string]int32
 }
 
 // SubmitJob remote procedure call used to submit a job to one of the OBI infrastructures
@@ -56,9 +64,52 @@ func (m *ObiMaster) SubmitJob(ctx context.Context,
 		jobType = model.JobTypeUndefined
 	}
 
+	// Reject requests for cluster profiles which do not exist
+	if jobRequest.Profile != "" {
+		if _, ok := config.Get().ClusterProfile(jobRequest.Profile); !ok {
+			logrus.WithField("profile", jobRequest.Profile).Warning("Job requested an unknown cluster profile")
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown cluster profile '%s'", jobRequest.Profile)
+		}
+	}
+
+	for _, label := range append(append([]string(nil), jobRequest.Affinity...), jobRequest.AntiAffinity...) {
+		if label == "" || strings.Contains(label, ",") {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid affinity label '%s'", label)
+		}
+	}
+
+	for _, request := range jobRequest.Webhooks {
+		if _, err := newWebhook(request, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if jobRequest.MaxRetries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid number of retries %d", jobRequest.MaxRetries)
+	}
+
 	md, _ := metadata.FromIncomingContext(ctx)
 	userID, _ := strconv.Atoi(md["userid"][0])
 
+	// Route the job to the requested infrastructure, if the user is allowed to use it
+	infra, ok := config.Get().Infrastructure(jobRequest.Infrastructure)
+	if !ok {
+		logrus.WithField("infrastructure", jobRequest.Infrastructure).Warning("Job requested an unknown infrastructure")
+		return nil, status.Errorf(codes.NotFound, "Unknown infrastructure '%s'", jobRequest.Infrastructure)
+	}
+	team, err := persistent.GetUserTeam(userID)
+	if err != nil {
+		logrus.WithField("error", err).Error("Could not read the team of the user")
+		return nil, status.Error(codes.Internal, "Unable to check the access to the infrastructure")
+	}
+	if !infra.Allows(userID, team) {
+		logrus.WithFields(logrus.Fields{
+			"userID":         userID,
+			"infrastructure": infra.Name,
+		}).Warning("User not allowed to submit jobs to the infrastructure")
+		return nil, status.Errorf(codes.PermissionDenied, "Not allowed to use infrastructure '%s'", infra.Name)
+	}
+
 	// Create job structure
 	job := model.Job{
 		CreationTimestamp:  time.Now(),
@@ -68,6 +119,16 @@ func (m *ObiMaster) SubmitJob(ctx context.Context,
 		Status: 			model.JobStatusPending,
 		Args:               jobRequest.JobArgs,
 		Author:             userID,
+		PredictedDuration:  jobRequest.Duration,
+		FailureProbability: jobRequest.FailureProbability,
+		Profile:            jobRequest.Profile,
+		Affinity:           jobRequest.Affinity,
+		AntiAffinity:       jobRequest.AntiAffinity,
+		MaxRetries:         jobRequest.MaxRetries,
+		Infrastructure:     infra.Name,
+	}
+	if jobRequest.Deadline > 0 {
+		job.Deadline = time.Unix(jobRequest.Deadline, 0)
 	}
 
 	// Generate predictions before submitting the job
@@ -79,8 +140,8 @@ func (m *ObiMaster) SubmitJob(ctx context.Context,
 			Metrics: model.MetricsDidBorn,
 		})
 	if err != nil {
+		// Rely on the estimations provided by the user, if any
 		logrus.WithField("error", err).Warning("Could not generate predictions")
-		job.PredictedDuration = 0
 
 		if job.Priority < 0 {
 			job.Priority = 0
@@ -89,25 +150,79 @@ func (m *ObiMaster) SubmitJob(ctx context.Context,
 		logrus.WithFields(logrus.Fields{
 			"type": resp.Label,
 			"duration": resp.Duration,
+			"memory": resp.PeakMemoryMB,
+			"vcores": resp.VCores,
 		}).Info("New job")
 
-		job.PredictedDuration = resp.Duration
+		if resp.Duration > 0 {
+			job.PredictedDuration = resp.Duration
+		}
+		// A negative probability means that the predictor could not estimate it
+		if resp.FailureProbability >= 0 {
+			job.FailureProbability = resp.FailureProbability
+		}
+		job.PredictedMemoryMB = resp.PeakMemoryMB
+		job.PredictedVCores = resp.VCores
 
 		if val, ok := m.priorities[resp.Label]; ok && job.Priority < 0 {
-			job.Priority = int32(val)
+			job.Priority = val
 		}
 	}
 
 	// Write submitted job into persistent storage
 	persistent.Write(&job)
 
+	// Subscribe the webhooks of the job before any of its events is published
+	for _, request := range jobRequest.Webhooks {
+		webhook, _ := newWebhook(request, userID, job.ID)
+		if err := persistent.Write(webhook); err != nil {
+			logrus.WithField("error", err).Error("Could not store webhook of the job")
+		}
+	}
+	events.PublishJob(events.JobSubmitted, &job)
+
 	// Send job execution request
-	logrus.WithField("priority-level", job.Priority).Info("Schedule job for execution")
-	m.scheduler.ScheduleJob(&job)
+	logrus.WithFields(logrus.Fields{
+		"priority-level": job.Priority,
+		"infrastructure": job.Infrastructure,
+	}).Info("Schedule job for execution")
+	m.schedulers[job.Infrastructure].ScheduleJob(&job)
 
 	return &SubmitJobResponse{Succeded: true, JobID: int32(job.ID)}, nil
 }
 
+// ListInfrastructures remote procedure call used to list the infrastructures the user issuing the request
+// can submit jobs to
+func (m *ObiMaster) ListInfrastructures(ctx context.Context,
+		request *ListInfrastructuresRequest) (*ListInfrastructuresResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	userID, _ := strconv.Atoi(md["userid"][0])
+	team, err := persistent.GetUserTeam(userID)
+	if err != nil {
+		logrus.WithField("error", err).Error("Could not read the team of the user")
+		return nil, status.Error(codes.Internal, "Unable to check the access to the infrastructures")
+	}
+
+	c := config.Get()
+	response := &ListInfrastructuresResponse{}
+	for _, name := range c.InfrastructureNames() {
+		infra := c.Infrastructures[name]
+		if !infra.Allows(userID, team) {
+			continue
+		}
+		response.Infrastructure = append(response.Infrastructure, &Infrastructure{
+			Name:             infra.Name,
+			Platform:         infra.Platform,
+			ProjectId:        infra.ProjectID,
+			Region:           infra.Region,
+			Zone:             infra.Zone,
+			SchedulingLevels: int32(len(infra.SchedulingLevels)),
+			Default:          name == c.DefaultInfrastructure,
+		})
+	}
+	return response, nil
+}
+
 // SubmitExecutable accepts and store an executable file
 func (m *ObiMaster) SubmitExecutable(stream ObiMaster_SubmitExecutableServer) error {
 	var filename string
@@ -135,68 +250,93 @@ func (m *ObiMaster) SubmitExecutable(stream ObiMaster_SubmitExecutableServer) er
 }
 
 // CreateMaster generates a new OBI master instance
-func CreateMaster() (*ObiMaster) {
-
-	// Load priority map
-	priorityMap := map[string]int{}
-	tmp := viper.GetStringMap("priorityMap")
-	for k, v := range tmp {
-		if vInt, ok := v.(int); ok {
-			priorityMap[k] = vInt
-		} else {
-			logrus.Panicln("Not integer value in the priority map.")
-		}
+// @param c is the validated configuration of the master
+func CreateMaster(c *config.Config) (*ObiMaster) {
+	platforms.Configure(c)
 
+	// Open connection to persistent storage, which the routines started below read and write from the beginning
+	if err := persistent.CreatePersistentConnection(); err != nil {
+		logrus.Fatal("Could not connect to persistent database")
 	}
+	logrus.Info("Connected to persistent database")
 
 	// Start up the pool
-	pool.GetPool().StartLivelinessMonitoring()
+	clusters := pool.New(pool.WithKillTimeout(c.Pool.KillTimeout), pool.WithCheckInterval(c.Pool.CheckInterval))
+	clusters.StartLivelinessMonitoring()
+	clusters.StartLifecycleMonitoring()
+	clusters.StartWarmPool(c.WarmPool)
+	clusters.StartReconciler(c.Reconciler)
 
-	// Setup scheduler
-	submitter := pool.NewSubmitter()
-	scheduler := scheduling.New(submitter)
-	scheduler.SetupConfig()
+	// Setup a scheduler for each infrastructure
+	schedulers := make(map[string]*scheduling.Scheduler)
+	for _, name := range c.InfrastructureNames() {
+		infra := c.Infrastructures[name]
+		scheduler := scheduling.New(clusters, pool.NewSubmitter(clusters, infra))
+		scheduler.SetupInfrastructure(c, infra)
+		schedulers[name] = scheduler
+	}
 
 	// Setup heartbeat
-	hb := heartbeat.New()
+	hb := heartbeat.New(clusters)
 
 	// Start everything
 	hb.Start()
-	scheduler.Start()
+	for _, scheduler := range schedulers {
+		scheduler.Start()
+	}
 
 	// Open connection to predictor server
-	serverAddr := fmt.Sprintf("%s:%d",
-		os.Getenv("PREDICTOR_SERVICE_DNS_NAME"),
-		8080)
+	serverAddr := c.PredictorAddress()
 	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
 	if err != nil {
 		logrus.Fatalf("fail to dial: %v", err)
 	}
 	pClient := predictor.NewObiPredictorClient(conn)
 
-	// Open connection to persistent storage
-	err = persistent.CreatePersistentConnection()
-	if err != nil {
-		logrus.Fatal("Could not connect to persistent database")
-	}
-	logrus.Info("Connected to persistent database")
+	// Deliver the webhook notifications
+	notifier := webhooks.New(c.Webhooks)
+	notifier.Start()
 
 	// Create and return OBI master object
 	master := ObiMaster {
-		scheduler: scheduler,
+		schedulers: schedulers,
 		heartbeatReceiver: hb,
+		notifier: notifier,
 		predictorClient: &pClient,
-		priorities: priorityMap,
+		priorities: c.PriorityMap,
 	}
 
-	// Recover from failure by rescheduling any jobs which are still in the pending state
+	clusters.SetJobRequeuer(master.scheduleJob)
+
+	// Recover from failure by restoring the deployments waiting for the cluster limits and by rescheduling
+	// any other jobs which are still in the pending state
+	queuedJobs := clusters.RestoreDeploymentQueue()
+	clusters.StartDeploymentQueue()
 	pendingJobs, err := persistent.GetPendingJobs()
 	if err != nil {
 		logrus.WithField("error", err).Error("Unable to load pending jobs from database")
 	}
 	for _, job := range pendingJobs {
-		master.scheduler.ScheduleJob(job)
+		if !queuedJobs[job.ID] {
+			master.scheduleJob(job)
+		}
 	}
 
 	return &master
 }
+
+// scheduleJob hands a job to the scheduler of its infrastructure, the default one if the infrastructure does
+// not exist anymore
+// @param job is the job to schedule
+func (m *ObiMaster) scheduleJob(job *model.Job) {
+	scheduler, ok := m.schedulers[job.Infrastructure]
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"jobID":          job.ID,
+			"infrastructure": job.Infrastructure,
+		}).Warning("Unknown infrastructure, scheduling the job in the default one")
+		job.Infrastructure = config.Get().DefaultInfrastructure
+		scheduler = m.schedulers[job.Infrastructure]
+	}
+	scheduler.ScheduleJob(job)
+}
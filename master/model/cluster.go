@@ -27,12 +27,18 @@ const (
 	ClusterStatusRunning = iota
 	// ClusterStatusClosed attached to a cluster when it is closed
 	ClusterStatusClosed  = iota
+	// ClusterStatusDeleting attached to a cluster when its resources are being released
+	ClusterStatusDeleting = iota
+	// ClusterStatusIdle attached to a warm cluster waiting to be claimed by some jobs
+	ClusterStatusIdle = iota
 )
 
 // ClusterStatusNames descriptive names for different cluster statuses
 var ClusterStatusNames = map[ClusterStatus]string {
 	ClusterStatusRunning: "running",
 	ClusterStatusClosed: "closed",
+	ClusterStatusDeleting: "deleting",
+	ClusterStatusIdle: "idle",
 }
 
 // Scalable is the interface that must be implemented from a scalable cluster
@@ -45,12 +51,20 @@ type ClusterBase struct {
 	Name          string
 	WorkerNodes   int32
 	Platform      string
+	// Infrastructure is the name of the infrastructure the cluster belongs to
+	Infrastructure string
 	CreationTimestamp time.Time
 	Cost float32
 	Status ClusterStatus
 	HeartbeatHost string
 	HeartbeatPort int
 	AssignedJobs  int32
+	SchedulingLevel int32
+	Profile       string
+	Warm          bool
+	WarmCost      float32
+	// IdleSince is when the last job of the cluster ended, zero if the cluster never hosted a job
+	IdleSince     time.Time
 	Jobs *utils.ConcurrentSlice
 	metrics       *utils.ConcurrentSlice // not available outside package to prevent race conditions, get and set must be used
 	sync.Mutex
@@ -60,6 +74,7 @@ type ClusterBase struct {
 type ClusterBaseInterface interface {
 	GetName() string
 	GetPlatform() string
+	GetInfrastructure() string
 	GetCreationTimestamp() time.Time
 	GetCost() float32
 	GetStatus() ClusterStatus
@@ -67,10 +82,25 @@ type ClusterBaseInterface interface {
 	SubmitJob(*Job) error
 	GetMetricsWindow() *utils.ConcurrentSlice
 	AddMetricsSnapshot(message HeartbeatMessage)
-	AllocateResources(highPerformance bool) error
+	AllocateResources(profile ClusterProfile) error
 	FreeResources() error
 	MonitorJobs()
+	StopMonitoringJobs()
+	GetJobStatus(*Job) (JobStatus, error)
 	GetAllocatedJobSlots() int
+	GetSchedulingLevel() int32
+	SetSchedulingLevel(int32)
+	GetProfile() string
+	GetJobs() []*Job
+	GetWorkerNodes() int32
+	GetPreemptibleNodes() int32
+	IsWarm() bool
+	GetWarmCost() float32
+	SetWarmCost(float32)
+	GetIdleSince() time.Time
+	ResetIdleSince()
+	CancelJob(*Job) error
+	sync.Locker
 }
 
 
@@ -84,7 +114,7 @@ func NewClusterBase(clusterName string, workers int32, platform string, hbHost s
 		Name:          clusterName,
 		WorkerNodes:   workers,
 		Platform:      platform,
-		CreationTimestamp: time.Now(),
+		CreationTimestamp: utils.Now(),
 		HeartbeatHost: hbHost,
 		HeartbeatPort: hbPort,
 		Jobs: 		   utils.NewConcurrentSlice(0, false),
@@ -98,6 +128,82 @@ func (c *ClusterBase) GetMetrics() *utils.ConcurrentSlice {
 	return c.metrics
 }
 
+// GetInfrastructure returns the name of the infrastructure the cluster belongs to
+func (c *ClusterBase) GetInfrastructure() string {
+	return c.Infrastructure
+}
+
+// GetSchedulingLevel returns the scheduling level whose jobs are hosted by the cluster
+func (c *ClusterBase) GetSchedulingLevel() int32 {
+	return c.SchedulingLevel
+}
+
+// SetSchedulingLevel sets the scheduling level whose jobs are hosted by the cluster
+func (c *ClusterBase) SetSchedulingLevel(level int32) {
+	c.SchedulingLevel = level
+}
+
+// GetProfile returns the name of the profile the cluster was created with
+func (c *ClusterBase) GetProfile() string {
+	return c.Profile
+}
+
+// GetWorkerNodes returns the number of primary workers of the cluster
+func (c *ClusterBase) GetWorkerNodes() int32 {
+	return c.WorkerNodes
+}
+
+// GetJobs returns the jobs currently assigned to the cluster
+func (c *ClusterBase) GetJobs() []*Job {
+	var jobs []*Job
+	for elem := range c.Jobs.Iter() {
+		if job, ok := elem.Value.(*Job); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// IsWarm tells whether the cluster was created in advance for the warm pool
+func (c *ClusterBase) IsWarm() bool {
+	return c.Warm
+}
+
+// GetWarmCost returns the cost in dollars spent while the cluster was idle in the warm pool
+func (c *ClusterBase) GetWarmCost() float32 {
+	return c.WarmCost
+}
+
+// SetWarmCost sets the cost in dollars spent while the cluster was idle in the warm pool
+func (c *ClusterBase) SetWarmCost(cost float32) {
+	c.WarmCost = cost
+}
+
+// GetIdleSince returns when the last job of the cluster ended, zero if the cluster never hosted a job.
+// It is only meaningful while the cluster has no jobs
+func (c *ClusterBase) GetIdleSince() time.Time {
+	return c.IdleSince
+}
+
+// ResetIdleSince marks the cluster as busy again, e.g. when new jobs are assigned to it while it is idle.
+// It must be called holding the lock of the cluster
+func (c *ClusterBase) ResetIdleSince() {
+	c.IdleSince = time.Time{}
+}
+
+// LastMetrics returns the most recent heartbeat in the given metrics window, if any
+func LastMetrics(window *utils.ConcurrentSlice) (HeartbeatMessage, bool) {
+	var last HeartbeatMessage
+	var found bool
+	for hb := range window.Iter() {
+		if hb.Value != nil {
+			last = hb.Value.(HeartbeatMessage)
+			found = true
+		}
+	}
+	return last, found
+}
+
 // SetMetrics is the setter of status field inside ClusterBase
 // thread-safe
 func (c *ClusterBase) SetMetrics(newStatus HeartbeatMessage) {
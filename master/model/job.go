@@ -48,6 +48,14 @@ var JobStatusNames = map[JobStatus]string {
 	JobStatusFailed: "failed",
 }
 
+// Ways in which the jobs whose predicted failure probability is above the threshold of their level are packed
+const (
+	// RiskIsolate deploys each risky job on a cluster of its own
+	RiskIsolate = "isolate"
+	// RiskGroup packs risky jobs only with other risky jobs
+	RiskGroup = "group"
+)
+
 // JobTypeNames descriptive names for different job types
 var JobTypeNames = map[JobType]string {
 	JobTypePySpark: "pyspark",
@@ -63,10 +71,105 @@ type Job struct {
 	ExecutablePath     string
 	Type               JobType
 	Priority           int32
+	ScheduleTimestamp  time.Time
 	Status             JobStatus
 	PredictedDuration  int32
+	PredictedMemoryMB  int32
+	PredictedVCores    int32
 	FailureProbability float32
 	Args 			   string
 	PlatformDependentID string
 	DriverOutputPath string
+	Deadline           time.Time
+	DeadlineMissed     bool
+	// Profile is the name of the cluster profile requested for the job, the one of its level if empty
+	Profile            string
+	// Jobs sharing an affinity label are packed on the same cluster whenever possible,
+	// jobs sharing an anti-affinity label never share a cluster
+	Affinity           []string
+	AntiAffinity       []string
+	// RiskIsolation is how the job was packed because of its predicted failure probability, empty if it was
+	// not considered risky
+	RiskIsolation      string
+	// MaxRetries is how many times the job is scheduled again when the cluster running it is lost
+	MaxRetries         int32
+	Retries            int32
+	// Infrastructure is the name of the infrastructure the job is routed to
+	Infrastructure     string
+	// FailureReason explains why the job was failed by OBI, empty if it failed on its own
+	FailureReason      string
+}
+
+// CheckDeadline marks the job as having missed its deadline, if any, when it ended after it
+func (j *Job) CheckDeadline(end time.Time) {
+	if !j.Deadline.IsZero() && end.After(j.Deadline) {
+		j.DeadlineMissed = true
+	}
+}
+
+// CanRetry checks whether the job can be scheduled again after losing the cluster running it
+func (j *Job) CanRetry() bool {
+	return j.Retries < j.MaxRetries
+}
+
+// SharesAffinity checks whether the two jobs have an affinity label in common
+func (j *Job) SharesAffinity(other *Job) bool {
+	return shareLabel(j.Affinity, other.Affinity)
+}
+
+// ConflictsWith checks whether the two jobs have an anti-affinity label in common, so that they
+// cannot run on the same cluster
+func (j *Job) ConflictsWith(other *Job) bool {
+	return shareLabel(j.AntiAffinity, other.AntiAffinity)
+}
+
+func shareLabel(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FailureOutcome returns the record comparing the predicted failure probability of a job packed as a
+// risky one with its actual outcome
+// @param end is when the job ended
+// return the record, false if the job was not packed as a risky one
+func (j *Job) FailureOutcome(end time.Time) (*FailureOutcome, bool) {
+	if j.RiskIsolation == "" {
+		return nil, false
+	}
+	outcome := &FailureOutcome{
+		JobID:              j.ID,
+		FailureProbability: j.FailureProbability,
+		Isolation:          j.RiskIsolation,
+		Failed:             j.Status == JobStatusFailed,
+		Timestamp:          end,
+	}
+	if j.Cluster != nil {
+		outcome.ClusterName = j.Cluster.GetName()
+	}
+	return outcome, true
+}
+
+// FailureOutcome records how a risky job ended, to evaluate the failure-aware packing
+type FailureOutcome struct {
+	JobID              int
+	ClusterName        string
+	FailureProbability float32
+	Isolation          string
+	Failed             bool
+	Timestamp          time.Time
+}
+
+// JobPromotion records the move of a job to a higher scheduling level
+type JobPromotion struct {
+	JobID     int
+	FromLevel int32
+	ToLevel   int32
+	Reason    string
+	Timestamp time.Time
 }
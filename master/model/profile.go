@@ -0,0 +1,116 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package model
+
+// Names of the cluster profiles which are always available
+const (
+	StandardProfile        = "standard"
+	HighPerformanceProfile = "high-performance"
+)
+
+// ClusterProfile describes the shape of a cluster: its machines, its size and how it is autoscaled
+type ClusterProfile struct {
+	Name                   string
+	MasterMachineType      string
+	WorkerMachineType      string
+	PreemptibleMachineType string
+	// WorkerNodes is the minimum number of primary workers, more are added when the predicted demand requires it
+	WorkerNodes         int32
+	PreemptibleNodes    int32
+	MinPreemptibleNodes int32
+	// DiskSizeGB is the boot disk size of each node
+	DiskSizeGB int32
+	// Image is the custom image of the nodes, the platform default one if empty
+	Image string
+	// Properties are the software properties of the cluster, e.g. "spark:spark.executor.cores"
+	Properties map[string]string
+	// YARN resources available on a single worker
+	NodeMemoryMB int32
+	NodeVCores   int32
+	// Costs in dollars of one hour of a node, of a preemptible node and of the platform fee of a node
+	NodeCostPerHour            float64
+	PreemptibleNodeCostPerHour float64
+	PlatformCostPerHour        float64
+	Autoscaling                AutoscalingProfile
+	Lifecycle                  LifecycleProfile
+}
+
+// AutoscalingProfile describes how the clusters of a profile are autoscaled
+type AutoscalingProfile struct {
+	// Policy is the name of the autoscaling policy, e.g. "workload"
+	Policy string
+	// Factor is the scaling factor of the policy, used when the scheduling level does not set one
+	Factor float32
+	// Interval is the number of seconds between two applications of the policy
+	Interval       int16
+	AllowDownscale bool
+	MaxAbsDelta    int16
+}
+
+// LifecycleProfile describes when the clusters of a profile are released by the pool
+type LifecycleProfile struct {
+	// IdleTimeout is the number of seconds a cluster is kept without jobs, e.g. for follow-up work,
+	// before being deleted
+	IdleTimeout int32
+	// MaxLifetime is the number of seconds after which a cluster is deleted, cancelling the jobs it is
+	// still running. No limit if 0
+	MaxLifetime int32
+}
+
+// sparkBlacklistProperties are the software properties of the built-in profiles
+var sparkBlacklistProperties = map[string]string{
+	"spark:spark.blacklist.enabled":                             "true",
+	"spark:spark.blacklist.timeout":                             "2m",
+	"spark:spark.blacklist.task.maxTaskAttemptsPerNode":         "2",
+	"spark:spark.blacklist.stage.maxFailedExecutorsPerNode":     "2",
+	"spark:spark.blacklist.application.maxFailedExecutorsPerNode": "2",
+}
+
+// BuiltinProfiles returns the profiles available even when they are not configured
+func BuiltinProfiles() map[string]ClusterProfile {
+	return map[string]ClusterProfile{
+		StandardProfile: {
+			Name:                       StandardProfile,
+			MasterMachineType:          "n1-standard-4",
+			WorkerMachineType:          "n1-standard-4",
+			PreemptibleMachineType:     "n1-standard-4",
+			WorkerNodes:                2,
+			DiskSizeGB:                 500,
+			Properties:                 sparkBlacklistProperties,
+			NodeMemoryMB:               12288,
+			NodeVCores:                 4,
+			NodeCostPerHour:            0.2448,
+			PreemptibleNodeCostPerHour: 0.0492,
+			PlatformCostPerHour:        0.04,
+			Autoscaling:                AutoscalingProfile{Policy: "workload", Interval: 60},
+		},
+		HighPerformanceProfile: {
+			Name:                       HighPerformanceProfile,
+			MasterMachineType:          "n1-highmem-16",
+			WorkerMachineType:          "n1-highmem-16",
+			PreemptibleMachineType:     "n1-highmem-16",
+			WorkerNodes:                7,
+			MinPreemptibleNodes:        10,
+			DiskSizeGB:                 500,
+			Properties:                 sparkBlacklistProperties,
+			NodeMemoryMB:               86016,
+			NodeVCores:                 16,
+			NodeCostPerHour:            1.2184,
+			PreemptibleNodeCostPerHour: 0.244,
+			PlatformCostPerHour:        0.32,
+			Autoscaling:                AutoscalingProfile{Policy: "workload", Interval: 60},
+		},
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// QueuedDeployment is the deployment of some jobs on a new cluster, waiting for the cluster limits to allow it
+type QueuedDeployment struct {
+	ID                int
+	Level             int32
+	Platform          string
+	Infrastructure    string
+	Profile           string
+	AutoscalingFactor float32
+	Demand            ResourceDemand
+	Jobs              []*Job
+	Timestamp         time.Time
+}
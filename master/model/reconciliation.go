@@ -0,0 +1,47 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// Policies applied by the reconciler to the clusters existing on a platform but missing from the pool
+const (
+	// ReconcileAdopt adds the cluster to the pool, as if it was created by this master
+	ReconcileAdopt = "adopt"
+	// ReconcileDelete releases the resources of the cluster
+	ReconcileDelete = "delete"
+	// ReconcileAlert only reports the cluster, once
+	ReconcileAlert = "alert"
+)
+
+// Actions taken by the reconciler besides the policies, to align the pool and the database with the platforms
+const (
+	// ReconcileRemove drops from the pool a cluster which does not exist anymore on its platform
+	ReconcileRemove = "remove"
+	// ReconcileClose marks as closed in the database a cluster which does not exist anymore on its platform
+	ReconcileClose = "close"
+)
+
+// ReconciliationAction records what the reconciler did about a cluster which was not consistent across
+// its platform, the pool and the database
+type ReconciliationAction struct {
+	ClusterName string
+	Platform    string
+	Action      string
+	Reason      string
+	Timestamp   time.Time
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package model
+
+// ResourceDemand describes the predicted resources needed by a job or by a group of jobs
+type ResourceDemand struct {
+	MemoryMB int32
+	VCores   int32
+	Duration int32
+}
+
+// Add sums the given demand to the current one
+func (d *ResourceDemand) Add(other ResourceDemand) {
+	d.MemoryMB += other.MemoryMB
+	d.VCores += other.VCores
+	d.Duration += other.Duration
+}
+
+// Demand returns the predicted resources needed by the job
+func (j *Job) Demand() ResourceDemand {
+	return ResourceDemand{
+		MemoryMB: j.PredictedMemoryMB,
+		VCores:   j.PredictedVCores,
+		Duration: j.PredictedDuration,
+	}
+}
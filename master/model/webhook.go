@@ -0,0 +1,61 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// Webhook is the subscription of a user to the events of all their jobs or of a single job, delivered
+// as signed HTTP callbacks
+type Webhook struct {
+	ID     int
+	UserID int
+	// JobID is the job whose events are delivered, 0 for all the jobs of the user
+	JobID int
+	URL   string
+	// Secret is the key signing the payloads
+	Secret string
+	// Events are the types of the events delivered, e.g. "job-finished"
+	Events    []string
+	Timestamp time.Time
+}
+
+// Subscribes checks whether the webhook delivers the given type of events
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is a payload waiting in the outbox to be delivered to a webhook
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	// URL and Secret of the webhook, only read from the database
+	URL     string
+	Secret  string
+	Event   string
+	Payload []byte
+	// Attempts is the number of failed deliveries so far
+	Attempts int32
+	// NextAttempt is when the payload will be delivered, zero once it was delivered or given up
+	NextAttempt time.Time
+	LastError   string
+	Delivered   time.Time
+}
@@ -22,9 +22,11 @@ import (
 		"obi/master/model"
 	"time"
 
-	_ "github.com/lib/pq" // this is required to use the Postgres connector
+	"github.com/lib/pq" // this is required to use the Postgres connector
 	"os"
 	"io/ioutil"
+	"strconv"
+	"strings"
 )
 
 var database *sql.DB
@@ -68,7 +70,7 @@ func CreatePersistentConnection() error {
 
 func initTables() error {
 	// Create users table
-	createUsersTableQuery := "CREATE TABLE IF NOT EXISTS Users (ID SERIAL PRIMARY KEY, Email TEXT, Password CHAR(60));"
+	createUsersTableQuery := "CREATE TABLE IF NOT EXISTS Users (ID SERIAL PRIMARY KEY, Email TEXT, Password CHAR(60), Team TEXT, Admin BOOLEAN DEFAULT FALSE);"
 
 	_, err := database.Exec(createUsersTableQuery)
 	if err != nil {
@@ -84,6 +86,9 @@ func initTables() error {
 		Cost FLOAT,
 		LastUpdateTimestamp TIMESTAMP,
 		AssignedJobs INT,
+		Warm BOOLEAN,
+		WarmCost FLOAT,
+		Infrastructure TEXT,
 		PRIMARY KEY(Name, CreationTimestamp))`
 
 	_, err = database.Exec(createClusterTableQuery)
@@ -104,16 +109,156 @@ func initTables() error {
 		Type TEXT, 
 		Priority INT,
 		PredictedDuration INT, 
+		PredictedMemoryMB INT,
+		PredictedVCores INT,
 		FailureProbability Float, 
 		Arguments TEXT, 
 		PlatformDependentID TEXT,
         DriverOutputURI TEXT,
+		Deadline TIMESTAMP,
+		DeadlineMissed BOOLEAN,
+		Profile TEXT,
+		Affinity TEXT,
+		AntiAffinity TEXT,
+		MaxRetries INT,
+		Retries INT,
+		Infrastructure TEXT,
+		FailureReason TEXT,
+		StartTimestamp TIMESTAMP,
+		CompletionTimestamp TIMESTAMP,
 		FOREIGN KEY (ClusterName, ClusterCreationTimestamp) REFERENCES Cluster(Name, CreationTimestamp)
 			ON DELETE CASCADE)`
 
 	_, err = database.Exec(createJobsTableQuery)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Create job promotion table
+	createJobPromotionTableQuery := `CREATE TABLE IF NOT EXISTS JobPromotion (
+		ID SERIAL PRIMARY KEY,
+		JobID INT REFERENCES Job(ID) ON DELETE CASCADE,
+		FromLevel INT,
+		ToLevel INT,
+		Reason TEXT,
+		Timestamp TIMESTAMP)`
+
+	_, err = database.Exec(createJobPromotionTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Create failure outcome table
+	createFailureOutcomeTableQuery := `CREATE TABLE IF NOT EXISTS FailureOutcome (
+		ID SERIAL PRIMARY KEY,
+		JobID INT REFERENCES Job(ID) ON DELETE CASCADE,
+		ClusterName TEXT,
+		FailureProbability FLOAT,
+		Isolation TEXT,
+		Failed BOOLEAN,
+		Timestamp TIMESTAMP)`
+
+	_, err = database.Exec(createFailureOutcomeTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Create deployment queue table
+	createDeploymentQueueTableQuery := `CREATE TABLE IF NOT EXISTS DeploymentQueue (
+		ID SERIAL PRIMARY KEY,
+		Level INT,
+		Platform TEXT,
+		Infrastructure TEXT,
+		Profile TEXT,
+		AutoscalingFactor FLOAT,
+		MemoryMB INT,
+		VCores INT,
+		Duration INT,
+		JobIDs TEXT,
+		Timestamp TIMESTAMP)`
+
+	_, err = database.Exec(createDeploymentQueueTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Create cluster reconciliation table
+	createClusterReconciliationTableQuery := `CREATE TABLE IF NOT EXISTS ClusterReconciliation (
+		ID SERIAL PRIMARY KEY,
+		ClusterName TEXT,
+		Platform TEXT,
+		Action TEXT,
+		Reason TEXT,
+		Timestamp TIMESTAMP)`
+
+	_, err = database.Exec(createClusterReconciliationTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Create webhook table
+	createWebhookTableQuery := `CREATE TABLE IF NOT EXISTS Webhook (
+		ID SERIAL PRIMARY KEY,
+		UserID INT REFERENCES Users(ID) ON DELETE CASCADE,
+		JobID INT,
+		URL TEXT,
+		Secret TEXT,
+		Events TEXT,
+		Timestamp TIMESTAMP)`
+
+	_, err = database.Exec(createWebhookTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Create webhook outbox table
+	createWebhookOutboxTableQuery := `CREATE TABLE IF NOT EXISTS WebhookOutbox (
+		ID SERIAL PRIMARY KEY,
+		WebhookID INT REFERENCES Webhook(ID) ON DELETE CASCADE,
+		Event TEXT,
+		Payload TEXT,
+		Attempts INT,
+		NextAttempt TIMESTAMP,
+		LastError TEXT,
+		DeliveredTimestamp TIMESTAMP)`
+
+	_, err = database.Exec(createWebhookOutboxTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Add the columns introduced after the tables were first created
+	for _, query := range migrations {
+		_, err = database.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrations contains the statements to update the schema of tables created by previous versions
+var migrations = []string{
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS PredictedMemoryMB INT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS PredictedVCores INT",
+	"ALTER TABLE Cluster ADD COLUMN IF NOT EXISTS Warm BOOLEAN",
+	"ALTER TABLE Cluster ADD COLUMN IF NOT EXISTS WarmCost FLOAT",
+	"ALTER TABLE Users ADD COLUMN IF NOT EXISTS Team TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS Deadline TIMESTAMP",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS DeadlineMissed BOOLEAN",
+	"ALTER TABLE Users ADD COLUMN IF NOT EXISTS Admin BOOLEAN DEFAULT FALSE",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS Profile TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS Affinity TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS AntiAffinity TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS MaxRetries INT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS Retries INT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS Infrastructure TEXT",
+	"ALTER TABLE Cluster ADD COLUMN IF NOT EXISTS Infrastructure TEXT",
+	"ALTER TABLE DeploymentQueue ADD COLUMN IF NOT EXISTS Infrastructure TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS FailureReason TEXT",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS StartTimestamp TIMESTAMP",
+	"ALTER TABLE Job ADD COLUMN IF NOT EXISTS CompletionTimestamp TIMESTAMP",
 }
 
 func getJobsByStatus(status, cluster string) ([]*model.Job, error) {
@@ -126,13 +271,15 @@ func getJobsByStatus(status, cluster string) ([]*model.Job, error) {
 	var rows *sql.Rows
 	var err error
 	if len(cluster) == 0 {
-		query := `SELECT ID, CreationTimestamp, ExecutablePath, Type, Status, Priority,
-			PredictedDuration, FailureProbability, Arguments, PlatformDependentID 
+		query := `SELECT ID, Author, CreationTimestamp, ExecutablePath, Type, Status, Priority,
+			PredictedDuration, PredictedMemoryMB, PredictedVCores, FailureProbability, Arguments, PlatformDependentID, Deadline, Profile,
+			Affinity, AntiAffinity, MaxRetries, Retries, Infrastructure, FailureReason
 				FROM Job WHERE Status='$1'`
 		rows, err = database.Query(query, status)
 	} else {
-		query := `SELECT ID, CreationTimestamp, ExecutablePath, Type, Status, Priority,
-			PredictedDuration, FailureProbability, Arguments, PlatformDependentID 
+		query := `SELECT ID, Author, CreationTimestamp, ExecutablePath, Type, Status, Priority,
+			PredictedDuration, PredictedMemoryMB, PredictedVCores, FailureProbability, Arguments, PlatformDependentID, Deadline, Profile,
+			Affinity, AntiAffinity, MaxRetries, Retries, Infrastructure, FailureReason
 				FROM Job WHERE Status='$1' AND ClusterName='$2'`
 		rows, err = database.Query(query, status, cluster)
 	}
@@ -151,8 +298,9 @@ func GetPendingJobs() ([]*model.Job, error) {
 	}
 
 	// Query jobs
-	query := `SELECT ID, CreationTimestamp, ExecutablePath, Type, Status, Priority,
-			PredictedDuration, FailureProbability, Arguments, PlatformDependentID 
+	query := `SELECT ID, Author, CreationTimestamp, ExecutablePath, Type, Status, Priority,
+			PredictedDuration, PredictedMemoryMB, PredictedVCores, FailureProbability, Arguments, PlatformDependentID, Deadline, Profile,
+			Affinity, AntiAffinity, MaxRetries, Retries, Infrastructure, FailureReason
 				FROM Job WHERE Status='pending'`
 	rows, err := database.Query(query)
 	defer rows.Close()
@@ -170,8 +318,9 @@ func GetRunningJobs(cluster string) ([]*model.Job, error) {
 	}
 
 	// Query jobs
-	query := `SELECT ID, CreationTimestamp, ExecutablePath, Type, Status, Priority,
-			PredictedDuration, FailureProbability, Arguments, PlatformDependentID 
+	query := `SELECT ID, Author, CreationTimestamp, ExecutablePath, Type, Status, Priority,
+			PredictedDuration, PredictedMemoryMB, PredictedVCores, FailureProbability, Arguments, PlatformDependentID, Deadline, Profile,
+			Affinity, AntiAffinity, MaxRetries, Retries, Infrastructure, FailureReason
 				FROM Job WHERE Status='running' AND ClusterName=$1`
 	rows, err := database.Query(query, cluster)
 	defer rows.Close()
@@ -186,6 +335,7 @@ func extractJobsFromRows(rows *sql.Rows) ([]*model.Job, error) {
 
 	for rows.Next() {
 		var id int
+		var author sql.NullInt64
 		var creationTimestamp time.Time
 		var executablePath string
 		var jobTypeDescription string
@@ -193,14 +343,26 @@ func extractJobsFromRows(rows *sql.Rows) ([]*model.Job, error) {
 		var statusDescription string
 		var status model.JobStatus
 		var priority int32
-		var predictedDuration int
+		var predictedDuration int32
+		var predictedMemory sql.NullInt64
+		var predictedVCores sql.NullInt64
 		var failureProbability float32
 		var args string
 		var platformID string
+		var deadline pq.NullTime
+		var profile sql.NullString
+		var affinity sql.NullString
+		var antiAffinity sql.NullString
+		var maxRetries sql.NullInt64
+		var retries sql.NullInt64
+		var infrastructure sql.NullString
+		var failureReason sql.NullString
 
-		err := rows.Scan(&id, &creationTimestamp, &executablePath, &jobTypeDescription,
-			&statusDescription, &priority, &predictedDuration, &failureProbability, &args,
-			&platformID)
+		err := rows.Scan(&id, &author, &creationTimestamp, &executablePath, &jobTypeDescription,
+			&statusDescription, &priority, &predictedDuration, &predictedMemory, &predictedVCores,
+			&failureProbability, &args,
+			&platformID, &deadline, &profile, &affinity, &antiAffinity, &maxRetries, &retries,
+			&infrastructure, &failureReason)
 		if err != nil {
 			return nil, err
 		}
@@ -221,13 +383,26 @@ func extractJobsFromRows(rows *sql.Rows) ([]*model.Job, error) {
 
 		jobs = append(jobs, &model.Job{
 			ID:                  id,
+			Author:              int(author.Int64),
 			CreationTimestamp:   creationTimestamp,
 			ExecutablePath:      executablePath,
 			Type:                jobType,
 			Priority:            priority,
 			Status:              status,
+			PredictedDuration:   predictedDuration,
+			PredictedMemoryMB:   int32(predictedMemory.Int64),
+			PredictedVCores:     int32(predictedVCores.Int64),
+			FailureProbability:  failureProbability,
 			Args:                args,
 			PlatformDependentID: platformID,
+			Deadline:            deadline.Time,
+			Profile:             profile.String,
+			Affinity:            splitList(affinity.String),
+			AntiAffinity:        splitList(antiAffinity.String),
+			MaxRetries:          int32(maxRetries.Int64),
+			Retries:             int32(retries.Int64),
+			Infrastructure:      infrastructure.String,
+			FailureReason:       failureReason.String,
 		})
 	}
 
@@ -249,6 +424,18 @@ func Write(record interface{}) error {
 		return writeJob(record.(*model.Job))
 	case model.ClusterBaseInterface:
 		return writeCluster(record.(model.ClusterBaseInterface))
+	case *model.JobPromotion:
+		return writeJobPromotion(record.(*model.JobPromotion))
+	case *model.FailureOutcome:
+		return writeFailureOutcome(record.(*model.FailureOutcome))
+	case *model.QueuedDeployment:
+		return writeQueuedDeployment(record.(*model.QueuedDeployment))
+	case *model.ReconciliationAction:
+		return writeReconciliationAction(record.(*model.ReconciliationAction))
+	case *model.Webhook:
+		return writeWebhook(record.(*model.Webhook))
+	case *model.WebhookDelivery:
+		return writeWebhookDelivery(record.(*model.WebhookDelivery))
 	default:
 		return errors.New("invalid record type")
 	}
@@ -265,6 +452,309 @@ func writeJob(job *model.Job) error {
 	return updateJobQuery(job)
 }
 
+func writeJobPromotion(promotion *model.JobPromotion) error {
+	logrus.Info("Writing job promotion to persistent storage")
+
+	query := `INSERT INTO JobPromotion (JobID, FromLevel, ToLevel, Reason, Timestamp)
+			VALUES ($1, $2, $3, $4, $5)`
+	_, err := database.Exec(query,
+		promotion.JobID,
+		promotion.FromLevel,
+		promotion.ToLevel,
+		promotion.Reason,
+		promotion.Timestamp,
+	)
+	return err
+}
+
+func writeFailureOutcome(outcome *model.FailureOutcome) error {
+	logrus.Info("Writing failure outcome to persistent storage")
+
+	query := `INSERT INTO FailureOutcome (JobID, ClusterName, FailureProbability, Isolation, Failed, Timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := database.Exec(query,
+		outcome.JobID,
+		outcome.ClusterName,
+		outcome.FailureProbability,
+		outcome.Isolation,
+		outcome.Failed,
+		outcome.Timestamp,
+	)
+	return err
+}
+
+func writeReconciliationAction(action *model.ReconciliationAction) error {
+	logrus.Info("Writing cluster reconciliation action to persistent storage")
+
+	query := `INSERT INTO ClusterReconciliation (ClusterName, Platform, Action, Reason, Timestamp)
+			VALUES ($1, $2, $3, $4, $5)`
+	_, err := database.Exec(query,
+		action.ClusterName,
+		action.Platform,
+		action.Action,
+		action.Reason,
+		action.Timestamp,
+	)
+	return err
+}
+
+func writeWebhook(webhook *model.Webhook) error {
+	logrus.Info("Writing webhook to persistent storage")
+
+	query := `INSERT INTO Webhook (UserID, JobID, URL, Secret, Events, Timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING ID`
+	return database.QueryRow(query,
+		webhook.UserID,
+		webhook.JobID,
+		webhook.URL,
+		webhook.Secret,
+		strings.Join(webhook.Events, ","),
+		webhook.Timestamp,
+	).Scan(&webhook.ID)
+}
+
+func writeWebhookDelivery(delivery *model.WebhookDelivery) error {
+	logrus.Info("Writing webhook delivery to persistent storage")
+
+	// If the delivery has no ID set it is a new entry of the outbox, otherwise its attempts are updated
+	if delivery.ID == 0 {
+		query := `INSERT INTO WebhookOutbox (WebhookID, Event, Payload, Attempts, NextAttempt, LastError)
+				VALUES ($1, $2, $3, $4, $5, $6) RETURNING ID`
+		return database.QueryRow(query,
+			delivery.WebhookID,
+			delivery.Event,
+			string(delivery.Payload),
+			delivery.Attempts,
+			nullableTime(delivery.NextAttempt),
+			delivery.LastError,
+		).Scan(&delivery.ID)
+	}
+
+	query := `UPDATE WebhookOutbox SET
+				Attempts = $1,
+				NextAttempt = $2,
+				LastError = $3,
+				DeliveredTimestamp = $4
+			WHERE ID = $5`
+	_, err := database.Exec(query,
+		delivery.Attempts,
+		nullableTime(delivery.NextAttempt),
+		delivery.LastError,
+		nullableTime(delivery.Delivered),
+		delivery.ID,
+	)
+	return err
+}
+
+// GetWebhooks returns the webhooks of a user
+// @param userID is the identifier of the user
+func GetWebhooks(userID int) ([]*model.Webhook, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	query := `SELECT ID, UserID, JobID, URL, Secret, Events, Timestamp FROM Webhook WHERE UserID = $1 ORDER BY ID`
+	return queryWebhooks(query, userID)
+}
+
+// GetJobWebhooks returns the webhooks receiving the events of a job: the ones of the job itself and the ones
+// of all the jobs of its author
+// @param author is the identifier of the user who submitted the job
+// @param jobID is the identifier of the job
+func GetJobWebhooks(author int, jobID int) ([]*model.Webhook, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	query := `SELECT ID, UserID, JobID, URL, Secret, Events, Timestamp FROM Webhook
+				WHERE UserID = $1 AND JobID IN (0, $2) ORDER BY ID`
+	return queryWebhooks(query, author, jobID)
+}
+
+func queryWebhooks(query string, args ...interface{}) ([]*model.Webhook, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*model.Webhook
+	for rows.Next() {
+		var events string
+		webhook := &model.Webhook{}
+		err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.JobID, &webhook.URL, &webhook.Secret, &events,
+			&webhook.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = splitList(events)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook of a user, together with its pending deliveries
+// @param id is the identifier of the webhook
+// @param userID is the identifier of the user owning the webhook
+// return false if the user has no such webhook
+func DeleteWebhook(id int, userID int) (bool, error) {
+	// Check if database connection is open
+	if database == nil {
+		return false, errors.New("database connection is not open")
+	}
+
+	result, err := database.Exec(`DELETE FROM Webhook WHERE ID = $1 AND UserID = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// GetDueWebhookDeliveries returns the deliveries of the outbox which are due by the given time,
+// the oldest first
+// @param now is the current time
+// @param limit is the maximum number of deliveries returned
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	query := `SELECT o.ID, o.WebhookID, w.URL, w.Secret, o.Event, o.Payload, o.Attempts, o.NextAttempt
+				FROM WebhookOutbox o JOIN Webhook w ON o.WebhookID = w.ID
+				WHERE o.NextAttempt <= $1 ORDER BY o.NextAttempt LIMIT $2`
+	rows, err := database.Query(query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		var payload string
+		delivery := &model.WebhookDelivery{}
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.Secret, &delivery.Event,
+			&payload, &delivery.Attempts, &delivery.NextAttempt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetJobAuthor returns the identifier of the user who submitted a job
+// @param jobID is the identifier of the job
+func GetJobAuthor(jobID int) (int, error) {
+	// Check if database connection is open
+	if database == nil {
+		return 0, errors.New("database connection is not open")
+	}
+
+	var author int
+	err := database.QueryRow(`SELECT Author FROM Job WHERE ID = $1`, jobID).Scan(&author)
+	return author, err
+}
+
+func writeQueuedDeployment(deployment *model.QueuedDeployment) error {
+	logrus.Info("Writing queued deployment to persistent storage")
+
+	var jobIDs []string
+	for _, job := range deployment.Jobs {
+		jobIDs = append(jobIDs, strconv.Itoa(job.ID))
+	}
+	query := `INSERT INTO DeploymentQueue (Level, Platform, Infrastructure, Profile, AutoscalingFactor, MemoryMB,
+				VCores, Duration, JobIDs, Timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING ID`
+	return database.QueryRow(query,
+		deployment.Level,
+		deployment.Platform,
+		deployment.Infrastructure,
+		deployment.Profile,
+		deployment.AutoscalingFactor,
+		deployment.Demand.MemoryMB,
+		deployment.Demand.VCores,
+		deployment.Demand.Duration,
+		strings.Join(jobIDs, ","),
+		deployment.Timestamp,
+	).Scan(&deployment.ID)
+}
+
+// DeleteQueuedDeployment removes a deployment from the persistent queue once it left it
+// @param id is the identifier of the queued deployment
+func DeleteQueuedDeployment(id int) error {
+	// Check if database connection is open
+	if database == nil {
+		return errors.New("database connection is not open")
+	}
+
+	_, err := database.Exec(`DELETE FROM DeploymentQueue WHERE ID = $1`, id)
+	return err
+}
+
+// GetQueuedDeployments returns the deployments waiting in the persistent queue, in the order they were queued
+func GetQueuedDeployments() ([]*model.QueuedDeployment, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	rows, err := database.Query(`SELECT ID, Level, Platform, Infrastructure, Profile, AutoscalingFactor, MemoryMB,
+			VCores, Duration, JobIDs, Timestamp FROM DeploymentQueue ORDER BY ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deployments []*model.QueuedDeployment
+	jobIDs := make(map[*model.QueuedDeployment]string)
+	for rows.Next() {
+		var ids string
+		var infrastructure sql.NullString
+		deployment := &model.QueuedDeployment{}
+		err := rows.Scan(&deployment.ID, &deployment.Level, &deployment.Platform, &infrastructure, &deployment.Profile,
+			&deployment.AutoscalingFactor, &deployment.Demand.MemoryMB, &deployment.Demand.VCores,
+			&deployment.Demand.Duration, &ids, &deployment.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		deployment.Infrastructure = infrastructure.String
+		deployments = append(deployments, deployment)
+		jobIDs[deployment] = ids
+	}
+
+	for _, deployment := range deployments {
+		var ids []int64
+		for _, id := range splitList(jobIDs[deployment]) {
+			if value, err := strconv.ParseInt(id, 10, 64); err == nil {
+				ids = append(ids, value)
+			}
+		}
+		deployment.Jobs, err = getJobsByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deployments, nil
+}
+
+func getJobsByIDs(ids []int64) ([]*model.Job, error) {
+	query := `SELECT ID, Author, CreationTimestamp, ExecutablePath, Type, Status, Priority,
+			PredictedDuration, PredictedMemoryMB, PredictedVCores, FailureProbability, Arguments, PlatformDependentID, Deadline, Profile,
+			Affinity, AntiAffinity, MaxRetries, Retries, Infrastructure, FailureReason
+				FROM Job WHERE ID = ANY($1) ORDER BY ID`
+	rows, err := database.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return extractJobsFromRows(rows)
+}
+
 func writeCluster(cluster model.ClusterBaseInterface) error {
 	logrus.Info("Writing cluster to persistent storage")
 
@@ -287,12 +777,24 @@ func insertJobQuery(job *model.Job) error {
 				Type, 
 				Priority,
 				PredictedDuration, 
+				PredictedMemoryMB,
+				PredictedVCores,
 				FailureProbability, 
 				Arguments, 
 				PlatformDependentID,
-				DriverOutputURI)
+				DriverOutputURI,
+				Deadline,
+				DeadlineMissed,
+				Profile,
+				Affinity,
+				AntiAffinity,
+				MaxRetries,
+				Retries,
+				Infrastructure,
+				FailureReason)
 			VALUES (
-				$1, $2, $3, CURRENT_TIMESTAMP, $4, $5, $6, $7, $8, $9, $10, $11
+				$1, $2, $3, CURRENT_TIMESTAMP, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+				$19, $20, $21, $22
 			) RETURNING ID`
 	stmt, err := database.Prepare(query)
 	defer stmt.Close()
@@ -307,10 +809,21 @@ func insertJobQuery(job *model.Job) error {
 		model.JobTypeNames[job.Type],
 		job.Priority,
 		job.PredictedDuration,
+		job.PredictedMemoryMB,
+		job.PredictedVCores,
 		job.FailureProbability,
 		job.Args,
 		job.PlatformDependentID,
 		job.DriverOutputPath,
+		nullableTime(job.Deadline),
+		job.DeadlineMissed,
+		job.Profile,
+		strings.Join(job.Affinity, ","),
+		strings.Join(job.AntiAffinity, ","),
+		job.MaxRetries,
+		job.Retries,
+		job.Infrastructure,
+		job.FailureReason,
 	).Scan(&job.ID)
 	if err != nil {
 		return err
@@ -333,11 +846,26 @@ func updateJobQuery(job *model.Job) error {
 				Type = $6, 
 				Priority = $7,
 				PredictedDuration = $8, 
-				FailureProbability = $9, 
-				Arguments = $10, 
-				PlatformDependentID = $11,
-				DriverOutputURI = $12
-			WHERE Job.ID = $13;`
+				PredictedMemoryMB = $9,
+				PredictedVCores = $10,
+				FailureProbability = $11, 
+				Arguments = $12, 
+				PlatformDependentID = $13,
+				DriverOutputURI = $14,
+				Deadline = $15,
+				DeadlineMissed = $16,
+				Profile = $17,
+				Affinity = $18,
+				AntiAffinity = $19,
+				MaxRetries = $20,
+				Retries = $21,
+				Infrastructure = $22,
+				FailureReason = $23,
+				StartTimestamp = CASE WHEN $25 AND (StartTimestamp IS NULL OR Status <> 'running')
+					THEN CURRENT_TIMESTAMP ELSE StartTimestamp END,
+				CompletionTimestamp = CASE WHEN $26
+					THEN COALESCE(CompletionTimestamp, CURRENT_TIMESTAMP) ELSE NULL END
+			WHERE Job.ID = $24;`
 		stmt, err := database.Prepare(query)
 		defer stmt.Close()
 		if err != nil {
@@ -358,11 +886,24 @@ func updateJobQuery(job *model.Job) error {
 			model.JobTypeNames[job.Type],
 			job.Priority,
 			job.PredictedDuration,
+			job.PredictedMemoryMB,
+			job.PredictedVCores,
 			job.FailureProbability,
 			job.Args,
 			job.PlatformDependentID,
 			job.DriverOutputPath,
+			nullableTime(job.Deadline),
+			job.DeadlineMissed,
+			job.Profile,
+			strings.Join(job.Affinity, ","),
+			strings.Join(job.AntiAffinity, ","),
+			job.MaxRetries,
+			job.Retries,
+			job.Infrastructure,
+			job.FailureReason,
 			job.ID,
+			job.Status == model.JobStatusRunning,
+			isFinished(job.Status),
 		).Scan()
 	}
 	// Cluster creation failure case
@@ -374,11 +915,24 @@ func updateJobQuery(job *model.Job) error {
 				Type = $4, 
 				Priority = $5,
 				PredictedDuration = $6, 
-				FailureProbability = $7, 
-				Arguments = $8, 
-				PlatformDependentID = $9,
-				DriverOutputURI = $10
-			WHERE Job.ID = $11;`
+				PredictedMemoryMB = $7,
+				PredictedVCores = $8,
+				FailureProbability = $9, 
+				Arguments = $10, 
+				PlatformDependentID = $11,
+				DriverOutputURI = $12,
+				Deadline = $13,
+				DeadlineMissed = $14,
+				Profile = $15,
+				Affinity = $16,
+				AntiAffinity = $17,
+				MaxRetries = $18,
+				Retries = $19,
+				Infrastructure = $20,
+				FailureReason = $21,
+				CompletionTimestamp = CASE WHEN $23
+					THEN COALESCE(CompletionTimestamp, CURRENT_TIMESTAMP) ELSE NULL END
+			WHERE Job.ID = $22;`
 	stmt, err := database.Prepare(query)
 	defer stmt.Close()
 	if err != nil {
@@ -391,14 +945,32 @@ func updateJobQuery(job *model.Job) error {
 		model.JobTypeNames[job.Type],
 		job.Priority,
 		job.PredictedDuration,
+		job.PredictedMemoryMB,
+		job.PredictedVCores,
 		job.FailureProbability,
 		job.Args,
 		job.PlatformDependentID,
 		job.DriverOutputPath,
+		nullableTime(job.Deadline),
+		job.DeadlineMissed,
+		job.Profile,
+		strings.Join(job.Affinity, ","),
+		strings.Join(job.AntiAffinity, ","),
+		job.MaxRetries,
+		job.Retries,
+		job.Infrastructure,
+		job.FailureReason,
 		job.ID,
+		isFinished(job.Status),
 	).Scan()
 }
 
+// isFinished tells whether a job in the given status has ended its execution
+// @param status is the status of the job
+func isFinished(status model.JobStatus) bool {
+	return status == model.JobStatusCompleted || status == model.JobStatusFailed
+}
+
 func insertClusterQuery(cluster model.ClusterBaseInterface) error {
 	query := `INSERT INTO Cluster (
 				Name, 
@@ -407,9 +979,12 @@ func insertClusterQuery(cluster model.ClusterBaseInterface) error {
 				CreationTimestamp, 
 				Cost,
 				LastUpdateTimestamp,
-				AssignedJobs)
+				AssignedJobs,
+				Warm,
+				WarmCost,
+				Infrastructure)
 			VALUES (
-				$1, $2, $3, $4, 0.0, CURRENT_TIMESTAMP, $5
+				$1, $2, $3, $4, 0.0, CURRENT_TIMESTAMP, $5, $6, $7, $8
 			)`
 	stmt, err := database.Prepare(query)
 	defer stmt.Close()
@@ -422,6 +997,9 @@ func insertClusterQuery(cluster model.ClusterBaseInterface) error {
 		model.ClusterStatusNames[cluster.GetStatus()],
 		cluster.GetCreationTimestamp(),
 		cluster.GetAllocatedJobSlots(),
+		cluster.IsWarm(),
+		cluster.GetWarmCost(),
+		cluster.GetInfrastructure(),
 	).Scan()
 }
 
@@ -455,8 +1033,10 @@ func updateClusterQuery(cluster model.ClusterBaseInterface) error {
 				Status = $2, 
 				Cost = $3,
 				LastUpdateTimestamp = CURRENT_TIMESTAMP,
-				AssignedJobs = $4
-			WHERE Cluster.Name = $5 AND Cluster.CreationTimestamp = $6;`
+				AssignedJobs = $4,
+				Warm = $5,
+				WarmCost = $6
+			WHERE Cluster.Name = $7 AND Cluster.CreationTimestamp = $8;`
 	stmt, err := database.Prepare(query)
 	defer stmt.Close()
 	if err != nil {
@@ -467,11 +1047,29 @@ func updateClusterQuery(cluster model.ClusterBaseInterface) error {
 		model.ClusterStatusNames[cluster.GetStatus()],
 		cluster.GetCost(),
 		cluster.GetAllocatedJobSlots(),
+		cluster.IsWarm(),
+		cluster.GetWarmCost(),
 		cluster.GetName(),
 		cluster.GetCreationTimestamp(),
 	).Scan()
 }
 
+// nullableTime maps the zero time to a NULL value
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// splitList parses a comma-separated list stored in a TEXT column
+func splitList(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+	return strings.Split(labels, ",")
+}
+
 func rowExists(query string, args ...interface{}) bool {
 	var exists bool
 	query = fmt.Sprintf("SELECT exists (%s)", query)
@@ -482,6 +1080,63 @@ func rowExists(query string, args ...interface{}) bool {
 	return exists
 }
 
+// ClusterRecord describes a cluster as recorded in the database
+type ClusterRecord struct {
+	Name              string
+	Platform          string
+	Infrastructure    string
+	Status            model.ClusterStatus
+	CreationTimestamp time.Time
+}
+
+// GetActiveClusters returns the clusters which are neither closed nor being deleted according to the database
+func GetActiveClusters() ([]*ClusterRecord, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	rows, err := database.Query(`SELECT Name, Platform, Infrastructure, Status, CreationTimestamp
+				FROM Cluster WHERE Status IN ('running', 'idle', 'deleting')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []*ClusterRecord
+	for rows.Next() {
+		var status string
+		var infrastructure sql.NullString
+		record := &ClusterRecord{}
+		err := rows.Scan(&record.Name, &record.Platform, &infrastructure, &status, &record.CreationTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		record.Infrastructure = infrastructure.String
+		for k, v := range model.ClusterStatusNames {
+			if status == v {
+				record.Status = k
+			}
+		}
+		clusters = append(clusters, record)
+	}
+	return clusters, nil
+}
+
+// CloseCluster marks as closed a cluster whose resources do not exist anymore
+// @param clusterName is the name of the cluster
+// @param creationTimestamp identifies the cluster among the ones with the same name
+func CloseCluster(clusterName string, creationTimestamp time.Time) error {
+	// Check if database connection is open
+	if database == nil {
+		return errors.New("database connection is not open")
+	}
+
+	_, err := database.Exec(`UPDATE Cluster SET Status = 'closed', LastUpdateTimestamp = CURRENT_TIMESTAMP
+				WHERE Name = $1 AND CreationTimestamp = $2`, clusterName, creationTimestamp)
+	return err
+}
+
 // ClusterExists queries the database to see if a certain cluster exists
 func ClusterExists(clusterName string) (bool, error) {
 	// Check if database connection is open
@@ -507,3 +1162,90 @@ func GetUserID(username string, password string) (int, error) {
 	}
 	return id, nil
 }
+
+// IsAdmin tells whether the given user is allowed to use the administration functionalities
+func IsAdmin(userID int) (bool, error) {
+	// Check if database connection is open
+	if database == nil {
+		return false, errors.New("database connection is not open")
+	}
+
+	var admin sql.NullBool
+	err := database.QueryRow(`SELECT Admin FROM Users WHERE ID = $1`, userID).Scan(&admin)
+	if err != nil {
+		return false, err
+	}
+	return admin.Valid && admin.Bool, nil
+}
+
+// GetUserTeams returns the team of each user which belongs to one
+func GetUserTeams() (map[int]string, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	rows, err := database.Query(`SELECT ID, Team FROM Users WHERE Team IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var team string
+		if err := rows.Scan(&id, &team); err != nil {
+			return nil, err
+		}
+		teams[id] = team
+	}
+	return teams, nil
+}
+
+// GetUserTeam returns the team of a user, empty if the user belongs to none
+// @param userID is the identifier of the user
+func GetUserTeam(userID int) (string, error) {
+	// Check if database connection is open
+	if database == nil {
+		return "", errors.New("database connection is not open")
+	}
+
+	var team sql.NullString
+	err := database.QueryRow(`SELECT Team FROM Users WHERE ID = $1`, userID).Scan(&team)
+	if err != nil {
+		return "", err
+	}
+	return team.String, nil
+}
+
+// GetUsageByAuthor returns, for each user, the seconds spent executing by the jobs which finished since the given time.
+// Only the part of the execution that falls after the given time is counted, and the time spent waiting in the queue
+// is never counted.
+func GetUsageByAuthor(since time.Time) (map[int]float64, error) {
+	// Check if database connection is open
+	if database == nil {
+		return nil, errors.New("database connection is not open")
+	}
+
+	query := `SELECT Author, SUM(EXTRACT(EPOCH FROM (CompletionTimestamp - GREATEST(StartTimestamp, $1))))
+				FROM Job WHERE Status IN ('completed', 'failed') AND CompletionTimestamp >= $1
+				AND StartTimestamp IS NOT NULL
+				GROUP BY Author`
+	rows, err := database.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[int]float64)
+	for rows.Next() {
+		var author int
+		var seconds float64
+		if err := rows.Scan(&author, &seconds); err != nil {
+			return nil, err
+		}
+		usage[author] = seconds
+	}
+	return usage, nil
+}
@@ -17,8 +17,10 @@ package platforms
 import (
 	"cloud.google.com/go/dataproc/apiv1"
 	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"obi/master/config"
+	"obi/master/events"
 	"google.golang.org/api/iterator"
 	dataprocpb "google.golang.org/genproto/googleapis/cloud/dataproc/v1"
 		"math"
@@ -27,6 +29,7 @@ import (
 	"obi/master/utils"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	dataproc2 "google.golang.org/api/dataproc/v1"
 	"golang.org/x/oauth2/google"
@@ -44,6 +47,46 @@ const DiskCost = 0.040 / 30 / 24 / 60 / 60
 // HeartbeatInterval interval of time at which each heartbeat is sent
 const HeartbeatInterval = 10
 
+// ManagedLabel is the label marking the clusters created by OBI, so that they can be told apart from the others
+// of the same project
+const ManagedLabel = "obi-managed"
+
+// MinWorkerNodes minimum number of primary workers of a Dataproc cluster
+const MinWorkerNodes = 2
+
+func init() {
+	Register(Platform{
+		Name: "dataproc",
+		New: func(base *m.ClusterBase, infra config.Infrastructure, profile m.ClusterProfile) Cluster {
+			return NewDataprocCluster(base, infra.ProjectID, infra.Zone, infra.Region, profile.MinPreemptibleNodes)
+		},
+		Existing: func(infra config.Infrastructure, clusterName string) (m.ClusterBaseInterface, error) {
+			cluster, err := NewExistingDataprocCluster(infra.ProjectID, infra.Region, infra.Zone, clusterName)
+			if err != nil {
+				return nil, err
+			}
+			cluster.Infrastructure = infra.Name
+			return cluster, nil
+		},
+		List: func(infra config.Infrastructure) ([]string, error) {
+			return ListDataprocClusters(infra.ProjectID, infra.Region)
+		},
+		// The project and the zone are inherited from the global settings when the infrastructure leaves them empty
+		Validate: func(infra config.Infrastructure) []error {
+			var errs []error
+			if infra.ProjectID == "" {
+				errs = append(errs, fmt.Errorf("projectId: required by the dataproc platform"))
+			}
+			if infra.Zone == "" {
+				errs = append(errs, fmt.Errorf("zone: required by the dataproc platform"))
+			}
+			return errs
+		},
+		Nodes:        dataprocNodesForDemand,
+		Capabilities: Capabilities{Heartbeats: true, Listable: true, RealTime: true},
+	})
+}
+
 // DataprocCluster is the extended cluster struct of Google Dataproc
 type DataprocCluster struct {
 	*m.ClusterBase
@@ -53,6 +96,8 @@ type DataprocCluster struct {
 	MinPreemptibleNodes int32
 	PreemptibleNodes int32
 	isMonitoring bool
+	stopMonitoring chan struct{}
+	stopOnce sync.Once
 }
 
 // NewDataprocCluster is the constructor of DataprocCluster struct
@@ -77,6 +122,8 @@ func NewDataprocCluster(
 		preemptibleNodes,
 		preemptibleNodes,
 		false,
+		make(chan struct{}),
+		sync.Once{},
 	}
 
 	// Recover running jobs (if anny)
@@ -94,6 +141,23 @@ func NewDataprocCluster(
 	return cluster
 }
 
+// dataprocNodesForDemand computes the number of primary workers needed to host the given demand, the cluster
+// being created with the preemptible workers of its profile
+// @param demand is the aggregate predicted demand of the jobs which will run on the cluster
+// @param profile is the profile of the cluster, giving the resources of each worker and the minimum number of them
+// return the number of primary workers and the number of preemptible ones
+func dataprocNodesForDemand(demand m.ResourceDemand, profile m.ClusterProfile) (int32, int32) {
+	_, preemptible := ProfileNodes(profile)
+	minWorkers := math.Max(float64(profile.WorkerNodes), MinWorkerNodes)
+	if profile.NodeMemoryMB <= 0 || profile.NodeVCores <= 0 {
+		return int32(minWorkers), preemptible
+	}
+
+	workers := math.Max(math.Ceil(float64(demand.MemoryMB)/float64(profile.NodeMemoryMB)),
+		math.Ceil(float64(demand.VCores)/float64(profile.NodeVCores)))
+	return int32(math.Max(workers, minWorkers)), preemptible
+}
+
 // NewExistingDataprocCluster is the constructor of DataprocCluster for already allocated resources in Dataproc
 // Even if OBI-master-old fails, it will be capable of rebuilding the pool, simply reading the content of the heartbeats
 // @param projectID is the project ID in the GCP environment
@@ -129,8 +193,10 @@ func NewExistingDataprocCluster(projectID string, region string, zone string, cl
 		newBaseCluster := m.NewClusterBase(clusterName,
 			resp.Config.WorkerConfig.NumInstances,
 			"dataproc",
-			viper.GetString("heart	beat.host"),
-			8080)
+			config.Get().HeartbeatHost,
+			config.Get().HeartbeatPort)
+		// The scheduling level of a recovered cluster is unknown, so it must not host new bins
+		newBaseCluster.SchedulingLevel = -1
 
 		// Update cluster base creation timestamp
 		ts, ok := persistent.GetRunningDatabaseCreationTimestamp(newBaseCluster.Name)
@@ -241,6 +307,7 @@ func (c *DataprocCluster) Scale(delta int32) bool {
 		"clusterName": c.Name,
 		"additionalWorkers": newSize,
 	}).Info("Scaling completed with secondary nodes.")
+	events.PublishCluster(events.ClusterScaled, c)
 
 	if c.PreemptibleNodes == 0 {
 		return true
@@ -290,6 +357,10 @@ func (c *DataprocCluster) SubmitJob(job *m.Job) error {
 	}
 
 	dataprocJob, err := controller.SubmitJob(ctx, req)
+	if err != nil {
+		logrus.WithField("error", err).Error("'SubmitJob' method call failed")
+		return err
+	}
 	job.PlatformDependentID = dataprocJob.Reference.JobId
 
 	logrus.WithField("cluster", c.ClusterBase.Name).Info("Cluster has been assigned with a new job")
@@ -297,10 +368,6 @@ func (c *DataprocCluster) SubmitJob(job *m.Job) error {
 	// Add job to the cluster's list
 	c.appendJob(job)
 
-	if err != nil {
-		logrus.WithField("error", err).Error("'SubmitJob' method call failed")
-		return err
-	}
 	logrus.WithField("clusterName", c.Name).Info("New job deployed")
 	return nil
 }
@@ -316,8 +383,14 @@ func (c *DataprocCluster) AddMetricsSnapshot(newMetrics m.HeartbeatMessage) {
 	c.SetMetrics(newMetrics)
 }
 
+// GetPreemptibleNodes returns the number of preemptible workers of the cluster
+func (c *DataprocCluster) GetPreemptibleNodes() int32 {
+	return c.PreemptibleNodes
+}
+
 // AllocateResources instantiate physical resources for the given cluster
-func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
+// @param profile describes the machines, the size and the software of the cluster
+func (c *DataprocCluster) AllocateResources(profile m.ClusterProfile) error {
 	// Create cluster controller
 	ctx := context.Background()
 	controller, err := dataproc.NewClusterControllerClient(ctx)
@@ -326,31 +399,34 @@ func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
 		return err
 	}
 
-	// Choose machine type
-	machineType := "n1-standard-4"
-	if highPerformance {
-		machineType = "n1-highmem-16"
-	}
-
-	// Update unitary costs based on the machine type
+	// Unitary costs of the machine types of the profile
 
 	// NormalNodeCostPerSecond unitary cost of a normal node
-	NormalNodeCostPerSecond := 0.2448 / 60 / 60
+	NormalNodeCostPerSecond := profile.NodeCostPerHour / 60 / 60
 	// PreemptibleNodeCostPerSecond unitary cost of a preemptible node
-	PreemptibleNodeCostPerSecond := 0.04920 / 60 / 60
+	PreemptibleNodeCostPerSecond := profile.PreemptibleNodeCostPerHour / 60 / 60
 	// DataprocNodeCost unitary cost of a Dataproc node per second
-	DataprocNodeCost := 0.04 / 60 / 60
+	DataprocNodeCost := profile.PlatformCostPerHour / 60 / 60
 
-	if highPerformance {
-		NormalNodeCostPerSecond = 1.2184 / 60 / 60
-		PreemptibleNodeCostPerSecond = 0.24400 / 60 / 60
-		DataprocNodeCost = 0.32 / 60 / 60
+	// Size the cluster according to the profile
+	if c.WorkerNodes < profile.WorkerNodes {
+		c.WorkerNodes = profile.WorkerNodes
+	}
+	c.PreemptibleNodes = profile.PreemptibleNodes
+	if c.PreemptibleNodes < c.MinPreemptibleNodes {
+		c.PreemptibleNodes = c.MinPreemptibleNodes
 	}
 
-	// Change number of executors in case of high performances
-	if highPerformance {
-		c.WorkerNodes = 7
-		c.PreemptibleNodes = 0
+	diskSize := profile.DiskSizeGB
+	if diskSize == 0 {
+		diskSize = NodeDiskSize
+	}
+	image := profile.Image
+	if image == "" {
+		image = config.Get().DataprocImage
+	}
+	diskConfig := &dataprocpb.DiskConfig{
+		BootDiskSizeGb: diskSize,
 	}
 
 	// Send request to allocate cluster resources
@@ -360,6 +436,9 @@ func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
 		Cluster: &dataprocpb.Cluster{
 			ProjectId: c.ProjectID,
 			ClusterName: c.Name,
+			Labels: map[string]string{
+				ManagedLabel: "true",
+			},
 			Config: &dataprocpb.ClusterConfig{
 				GceClusterConfig: &dataprocpb.GceClusterConfig{
 					ZoneUri: c.Zone,
@@ -368,25 +447,28 @@ func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
 						"obi-hb-port": strconv.Itoa(c.HeartbeatPort),
 						"normal-node-cost": strconv.FormatFloat(NormalNodeCostPerSecond, 'f', 16, 64),
 						"preemptible-node-cost": strconv.FormatFloat(PreemptibleNodeCostPerSecond, 'f', 16, 64),
-						"node-disk-size": strconv.FormatInt(NodeDiskSize, 10),
+						"node-disk-size": strconv.FormatInt(int64(diskSize), 10),
 						"disk-cost": strconv.FormatFloat(DiskCost, 'f', 16, 64),
 						"dp-node-cost": strconv.FormatFloat(DataprocNodeCost, 'f', 16, 64),
 						"interval": strconv.Itoa(HeartbeatInterval),
 					},
 				},
 				MasterConfig: &dataprocpb.InstanceGroupConfig{
-					//ImageUri: viper.GetString("dataproc-image"),
-					MachineTypeUri: machineType,
+					ImageUri: image,
+					MachineTypeUri: profile.MasterMachineType,
+					DiskConfig: diskConfig,
 				},
 				WorkerConfig: &dataprocpb.InstanceGroupConfig{
-					//ImageUri: viper.GetString("dataproc-image"),
+					ImageUri: image,
 					NumInstances: int32(c.WorkerNodes),
-					MachineTypeUri: machineType,
+					MachineTypeUri: profile.WorkerMachineType,
+					DiskConfig: diskConfig,
 				},
 				SecondaryWorkerConfig: &dataprocpb.InstanceGroupConfig{
-					//ImageUri: viper.GetString("dataproc-image"),
+					ImageUri: image,
 					NumInstances: int32(c.PreemptibleNodes),
-					MachineTypeUri: machineType,
+					MachineTypeUri: profile.PreemptibleMachineType,
+					DiskConfig: diskConfig,
 				},
 				InitializationActions: []*dataprocpb.NodeInitializationAction{
 					{
@@ -394,17 +476,12 @@ func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
 					},
 				},
 				SoftwareConfig: &dataprocpb.SoftwareConfig{
-					Properties:	map[string]string{
-						"spark:spark.blacklist.enabled": "true",
-						"spark:spark.blacklist.timeout": "2m",
-						"spark:spark.blacklist.task.maxTaskAttemptsPerNode": "2",
-						"spark:spark.blacklist.stage.maxFailedExecutorsPerNode": "2",
-						"spark:spark.blacklist.application.maxFailedExecutorsPerNode": "2",
-					},
+					Properties:	profile.Properties,
 				},
 			},
 		},
 	}
+	events.PublishCluster(events.ClusterCreating, c)
 	op, err := controller.CreateCluster(ctx, req)
 	if err != nil {
 		logrus.WithField("error", err).Error("'CreateCluster' method call failed")
@@ -419,6 +496,7 @@ func (c *DataprocCluster) AllocateResources(highPerformance bool) error {
 	}
 	c.Status = m.ClusterStatusRunning
 	logrus.WithField("name", c.Name).Info("New cluster on Dataproc platform")
+	events.PublishCluster(events.ClusterRunning, c)
 
 	// Write created cluster interface to persistent database
 	persistent.Write(c)
@@ -453,6 +531,7 @@ func (c *DataprocCluster) FreeResources() error {
 	// Update persistent storage
 	c.Status = m.ClusterStatusClosed
 	persistent.Write(c)
+	events.PublishCluster(events.ClusterDeleted, c)
 
 	return nil
 }
@@ -482,8 +561,17 @@ func (c *DataprocCluster) MonitorJobs() {
 
 	logrus.WithField("cluster-name", c.Name).Info("Starting jobs monitoring routine")
 
+	// Jobs already seen running by the platform
+	started := make(map[*m.Job]bool)
+
 	for {
-		time.Sleep(time.Second * 30)
+		select {
+		case <-c.stopMonitoring:
+			logrus.WithField("cluster-name", c.Name).Info("Jobs monitoring routine stopped")
+			return
+		case <-time.After(time.Second * 30):
+		}
+		ended := false
 		for elem := range c.Jobs.Iter() {
 			job := elem.Value.(*m.Job)
 			// Query job controller
@@ -498,6 +586,11 @@ func (c *DataprocCluster) MonitorJobs() {
 				persistent.Write(job)
 			}
 
+			if j.Status.State == dataprocpb.JobStatus_RUNNING && !started[job] {
+				started[job] = true
+				events.PublishJob(events.JobStarted, job)
+			}
+
 			if j.Status.State == dataprocpb.JobStatus_DONE ||
 				j.Status.State == dataprocpb.JobStatus_ERROR ||
 				j.Status.State == dataprocpb.JobStatus_CANCELLED {
@@ -511,28 +604,95 @@ func (c *DataprocCluster) MonitorJobs() {
 					job.Status = m.JobStatusFailed
 				}
 
+				job.CheckDeadline(time.Now())
+
 				// Update job in persistent store if its state changed
 				if previousState != job.Status {
 					persistent.Write(job)
+					if outcome, ok := job.FailureOutcome(time.Now()); ok {
+						persistent.Write(outcome)
+					}
+					events.PublishJob(events.JobFinished, job)
 				}
+				delete(started, job)
 
 				// Drop job from the cluster's jobs list
 				c.Jobs.MarkTombstone(elem.Index)
+				ended = true
 			}
 		}
 		// Force synchronization between tombstone markers and concurrent slice
 		c.Jobs.Sync()
-		// Eventually release resources
-		if c.Jobs.Len() == 0 {
-			logrus.WithField("cluster", c.Name).Info("Freeing resources")
-			err = c.FreeResources()
-			if err == nil {
-				break
-			}
+		// The pool releases the cluster once it has been idle long enough, unless new jobs are assigned to it
+		c.Lock()
+		if ended && c.Jobs.Len() == 0 {
+			c.IdleSince = utils.Now()
 		}
+		c.Unlock()
+	}
+}
+
+// StopMonitoringJobs stops the job monitoring routine, e.g. when the cluster is lost
+func (c *DataprocCluster) StopMonitoringJobs() {
+	c.stopOnce.Do(func() {
+		close(c.stopMonitoring)
+	})
+}
+
+// CancelJob asks Dataproc to stop a job running on the cluster
+func (c *DataprocCluster) CancelJob(job *m.Job) error {
+	if job.PlatformDependentID == "" {
+		return fmt.Errorf("job %d was never submitted to Dataproc", job.ID)
 	}
 
-	logrus.WithField("cluster-name", c.Name).Info("Stopping jobs monitoring routine")
+	ctx := context.Background()
+	controller, err := dataproc.NewJobControllerClient(ctx)
+	if err != nil {
+		logrus.WithField("error", err).Error("'NewJobControllerClient' method call failed")
+		return err
+	}
+	_, err = controller.CancelJob(ctx, &dataprocpb.CancelJobRequest{
+		ProjectId: c.ProjectID,
+		Region:    c.Region,
+		JobId:     job.PlatformDependentID,
+	})
+	if err != nil {
+		logrus.WithField("error", err).Error("'CancelJob' method call failed")
+		return err
+	}
+	return nil
+}
+
+// GetJobStatus queries Dataproc for the current status of a job submitted to the cluster
+func (c *DataprocCluster) GetJobStatus(job *m.Job) (m.JobStatus, error) {
+	if job.PlatformDependentID == "" {
+		return job.Status, fmt.Errorf("job %d was never submitted to Dataproc", job.ID)
+	}
+
+	ctx := context.Background()
+	controller, err := dataproc.NewJobControllerClient(ctx)
+	if err != nil {
+		logrus.WithField("error", err).Error("'NewJobControllerClient' method call failed")
+		return job.Status, err
+	}
+	j, err := controller.GetJob(ctx, &dataprocpb.GetJobRequest{
+		ProjectId: c.ProjectID,
+		Region:    c.Region,
+		JobId:     job.PlatformDependentID,
+	})
+	if err != nil {
+		logrus.WithField("error", err).Error("'GetJob' method call failed")
+		return job.Status, err
+	}
+
+	switch j.Status.State {
+	case dataprocpb.JobStatus_DONE:
+		return m.JobStatusCompleted, nil
+	case dataprocpb.JobStatus_ERROR, dataprocpb.JobStatus_CANCELLED:
+		return m.JobStatusFailed, nil
+	default:
+		return m.JobStatusRunning, nil
+	}
 }
 
 // GetCost returns cluster's cost so far in dollars
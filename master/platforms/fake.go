@@ -0,0 +1,494 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+	"net"
+	"obi/master/config"
+	"obi/master/events"
+	m "obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// fakeMonitorInterval is the interval at which the fake clusters check whether their jobs ended
+const fakeMonitorInterval = time.Second
+
+// FakeConfig describes how the fake platform behaves
+type FakeConfig struct {
+	config.Fake
+	// Duration returns how long the job runs. If it is not set the predicted duration of the job, multiplied by
+	// the duration scale, is used
+	Duration func(job *m.Job) time.Duration
+	// Fails tells whether the job fails. If it is not set jobs fail randomly according to the failure rate
+	Fails func(job *m.Job) bool
+}
+
+// Fake is the configuration of the fake platform, to be set before any fake cluster is created
+var Fake = FakeConfig{
+	Fake: config.Fake{
+		ProvisioningTime:     10,
+		JobDuration:          60,
+		DurationScale:        1,
+		HeartbeatInterval:    5,
+		ContainerMemoryMB:    2048,
+		DefaultJobContainers: 4,
+	},
+}
+
+func init() {
+	Register(Platform{
+		Name: "fake",
+		New: func(base *m.ClusterBase, infra config.Infrastructure, profile m.ClusterProfile) Cluster {
+			return NewFakeCluster(base, profile.MinPreemptibleNodes)
+		},
+		Existing: func(infra config.Infrastructure, clusterName string) (m.ClusterBaseInterface, error) {
+			return NewExistingFakeCluster(clusterName)
+		},
+		List: func(infra config.Infrastructure) ([]string, error) {
+			return ListFakeClusters()
+		},
+		Configure: func(c *config.Config) {
+			Fake.Fake = c.Fake
+		},
+		Nodes:        fakeNodesForDemand,
+		Capabilities: Capabilities{Heartbeats: true, Listable: true, RealTime: true},
+	})
+}
+
+// fakeNodesForDemand computes the number of primary workers whose containers can host the given demand, never
+// fewer than the workers of the profile, the cluster being created with the preemptible workers of its profile
+// @param demand is the aggregate predicted demand of the jobs which will run on the cluster
+// @param profile is the profile of the cluster, giving the resources of each worker
+// return the number of primary workers and the number of preemptible ones
+func fakeNodesForDemand(demand m.ResourceDemand, profile m.ClusterProfile) (int32, int32) {
+	_, preemptible := ProfileNodes(profile)
+	minWorkers := math.Max(float64(profile.WorkerNodes), 1)
+	perNode := math.Min(float64(profile.NodeVCores), float64(profile.NodeMemoryMB/Fake.ContainerMemoryMB))
+	if perNode <= 0 {
+		return int32(minWorkers), preemptible
+	}
+
+	containers := math.Max(math.Ceil(float64(demand.MemoryMB)/float64(Fake.ContainerMemoryMB)), float64(demand.VCores))
+	return int32(math.Max(math.Ceil(containers/perNode), minWorkers)), preemptible
+}
+
+// fakeClusters keeps the fake clusters which have not been released, so that they can be listed and
+// reconciled like the ones of the real platforms
+var fakeClusters struct {
+	clusters map[string]*FakeCluster
+	sync.Mutex
+}
+
+// FakeRun tracks the execution of a job on a fake cluster
+type FakeRun struct {
+	Job   *m.Job
+	Start time.Time
+	// Duration is how long the job runs once the cluster is ready
+	Duration   time.Duration
+	Fails      bool
+	containers int32
+}
+
+// FakeCluster is an in-memory cluster running on the real clock, meant to run the whole master locally and in
+// end-to-end tests. It takes some time to be provisioned, runs its jobs for a configurable duration, fails some
+// of them and sends YARN-like metrics to the heartbeat receiver as protobuf messages over UDP
+type FakeCluster struct {
+	*m.ClusterBase
+	yarnModel
+	EndTimestamp time.Time
+	runs         map[*m.Job]*FakeRun
+	// runsLock guards the runs, the cost and the size of the cluster, which change while the pool may hold
+	// the lock of the cluster
+	runsLock       sync.Mutex
+	isMonitoring   bool
+	stopMonitoring chan struct{}
+	stopOnce       sync.Once
+	quit           chan struct{}
+	quitOnce       sync.Once
+}
+
+// NewFakeCluster is the constructor of FakeCluster struct
+// @param baseInfo is the base object for a cluster
+// @param preemptibleNodes is the minimum number of preemptible workers of the cluster
+// return the pointer to the new FakeCluster instance
+func NewFakeCluster(baseInfo *m.ClusterBase, preemptibleNodes int32) *FakeCluster {
+	baseInfo.Platform = "fake"
+	return &FakeCluster{
+		ClusterBase:    baseInfo,
+		yarnModel:      newYarnModel(preemptibleNodes, Fake.ContainerMemoryMB, Fake.DefaultJobContainers),
+		runs:           make(map[*m.Job]*FakeRun),
+		stopMonitoring: make(chan struct{}),
+		quit:           make(chan struct{}),
+	}
+}
+
+// NewExistingFakeCluster returns a fake cluster which has not been released yet
+// @param clusterName is the name of the cluster
+func NewExistingFakeCluster(clusterName string) (*FakeCluster, error) {
+	fakeClusters.Lock()
+	defer fakeClusters.Unlock()
+	if cluster, ok := fakeClusters.clusters[clusterName]; ok {
+		return cluster, nil
+	}
+	return nil, fmt.Errorf("fake cluster '%s' does not exist", clusterName)
+}
+
+// ListFakeClusters returns the names of the fake clusters which have not been released yet
+func ListFakeClusters() ([]string, error) {
+	fakeClusters.Lock()
+	defer fakeClusters.Unlock()
+	names := make([]string, 0, len(fakeClusters.clusters))
+	for name := range fakeClusters.clusters {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Runs returns the executions of all the jobs submitted to the cluster
+func (c *FakeCluster) Runs() []*FakeRun {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	runs := make([]*FakeRun, 0, len(c.runs))
+	for _, run := range c.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// sendHeartbeats sends the metrics of the cluster to the heartbeat receiver at every heartbeat interval.
+// When no heartbeat address is set the metrics are recorded directly. It will be stop when the `quit`
+// channel is closed
+func (c *FakeCluster) sendHeartbeats() {
+	var conn net.Conn
+	if c.HeartbeatHost != "" {
+		var err error
+		conn, err = net.Dial("udp", fmt.Sprintf("%s:%d", c.HeartbeatHost, c.HeartbeatPort))
+		if err != nil {
+			logrus.WithField("error", err).Error("Unable to open the heartbeat connection of the fake cluster")
+		} else {
+			defer conn.Close()
+		}
+	}
+
+	ticker := time.NewTicker(time.Duration(Fake.HeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+	last := utils.Now()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+		now := utils.Now()
+		heartbeat := c.heartbeat(now.Sub(last), now)
+		last = now
+
+		if conn == nil {
+			c.AddMetricsSnapshot(heartbeat)
+			continue
+		}
+		data, err := proto.Marshal(&heartbeat)
+		if err != nil {
+			logrus.WithField("error", err).Error("'Marshal' method call for fake heartbeat failed")
+			continue
+		}
+		if _, err = conn.Write(data); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"clusterName": c.Name,
+				"error":       err,
+			}).Warning("Unable to send fake heartbeat")
+		}
+	}
+}
+
+// heartbeat accounts the cost of the workers over the given time and describes the YARN usage of the cluster
+func (c *FakeCluster) heartbeat(elapsed time.Duration, now time.Time) m.HeartbeatMessage {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	c.Cost += c.cost(c.WorkerNodes, elapsed)
+
+	var demand int32
+	for elem := range c.Jobs.Iter() {
+		if run, ok := c.runs[elem.Value.(*m.Job)]; ok {
+			demand += run.containers
+		}
+	}
+	return c.yarnModel.heartbeat(c.Name, c.WorkerNodes, int32(c.Jobs.Len()), demand, c.Cost, now)
+}
+
+// <-- start implementation of `Scalable` interface -->
+
+// Scale changes the number of preemptible workers of the cluster, new workers are available immediately
+// @param delta is the number of nodes to add or remove
+func (c *FakeCluster) Scale(delta int32) bool {
+	c.runsLock.Lock()
+	if !c.scale(delta) {
+		c.runsLock.Unlock()
+		return true
+	}
+	nodes := c.PreemptibleNodes
+	c.runsLock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"clusterName":       c.Name,
+		"additionalWorkers": nodes,
+	}).Info("Scaled fake cluster")
+	events.PublishCluster(events.ClusterScaled, c)
+
+	return nodes == 0
+}
+
+// <-- end implementation of `Scalable` interface -->
+
+// <-- start implementation of `ClusterBaseInterface` interface -->
+
+// GetName is for getting the name of the cluster
+func (c *FakeCluster) GetName() string {
+	return c.Name
+}
+
+// SubmitJob starts a job on the fake cluster, its duration and its outcome are decided right away
+func (c *FakeCluster) SubmitJob(job *m.Job) error {
+	duration := time.Duration(Fake.JobDuration) * time.Second
+	if job.PredictedDuration > 0 {
+		duration = time.Duration(float64(job.PredictedDuration) * Fake.DurationScale * float64(time.Second))
+	}
+	if Fake.Duration != nil {
+		duration = Fake.Duration(job)
+	}
+	fails := rand.Float64() < Fake.FailureRate
+	if Fake.Fails != nil {
+		fails = Fake.Fails(job)
+	}
+
+	c.runsLock.Lock()
+	job.PlatformDependentID = fmt.Sprintf("%s-job-%d", c.Name, len(c.runs)+1)
+	c.runs[job] = &FakeRun{
+		Job:        job,
+		Duration:   duration,
+		Fails:      fails,
+		containers: c.jobContainers(job),
+	}
+	c.runsLock.Unlock()
+
+	logrus.WithField("cluster", c.Name).Info("Cluster has been assigned with a new job")
+	c.appendJob(job)
+	return nil
+}
+
+// GetMetricsWindow returns the metrics of the cluster in the last heartbeats
+func (c *FakeCluster) GetMetricsWindow() *utils.ConcurrentSlice {
+	return c.GetMetrics()
+}
+
+// AddMetricsSnapshot adds a new heartbeat to the metrics window of the cluster
+func (c *FakeCluster) AddMetricsSnapshot(newMetrics m.HeartbeatMessage) {
+	c.SetMetrics(newMetrics)
+}
+
+// GetPreemptibleNodes returns the number of preemptible workers of the cluster
+func (c *FakeCluster) GetPreemptibleNodes() int32 {
+	return c.PreemptibleNodes
+}
+
+// AllocateResources waits for the provisioning time, then the cluster starts sending heartbeats
+// @param profile describes the size of the cluster and the resources and costs of its workers
+func (c *FakeCluster) AllocateResources(profile m.ClusterProfile) error {
+	c.runsLock.Lock()
+	c.WorkerNodes = c.allocate(profile, c.WorkerNodes)
+	c.runsLock.Unlock()
+	c.CreationTimestamp = utils.Now()
+	events.PublishCluster(events.ClusterCreating, c)
+
+	select {
+	case <-c.quit:
+		return fmt.Errorf("fake cluster '%s' released while being created", c.Name)
+	case <-time.After(time.Duration(Fake.ProvisioningTime) * time.Second):
+	}
+
+	fakeClusters.Lock()
+	if fakeClusters.clusters == nil {
+		fakeClusters.clusters = make(map[string]*FakeCluster)
+	}
+	fakeClusters.clusters[c.Name] = c
+	fakeClusters.Unlock()
+
+	c.Status = m.ClusterStatusRunning
+	logrus.WithField("name", c.Name).Info("New cluster on fake platform")
+	events.PublishCluster(events.ClusterRunning, c)
+	persistent.Write(c)
+
+	go c.sendHeartbeats()
+	return nil
+}
+
+// FreeResources releases the fake cluster, which stops sending heartbeats
+func (c *FakeCluster) FreeResources() error {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+	})
+	c.StopMonitoringJobs()
+
+	fakeClusters.Lock()
+	delete(fakeClusters.clusters, c.Name)
+	fakeClusters.Unlock()
+
+	c.Status = m.ClusterStatusClosed
+	c.EndTimestamp = utils.Now()
+	persistent.Write(c)
+	events.PublishCluster(events.ClusterDeleted, c)
+	logrus.WithField("name", c.Name).Info("Deleted cluster on fake platform")
+
+	return nil
+}
+
+// GetAllocatedJobSlots returns the number of jobs the cluster is currently handling
+func (c *FakeCluster) GetAllocatedJobSlots() int {
+	return c.Jobs.Len()
+}
+
+// GetPlatform returns cluster's platform type i.e. "fake"
+func (c *FakeCluster) GetPlatform() string {
+	return c.Platform
+}
+
+// GetCreationTimestamp return cluster's creation timestamp
+func (c *FakeCluster) GetCreationTimestamp() time.Time {
+	return c.CreationTimestamp
+}
+
+// MonitorJobs ends the jobs which have run for their duration, as failed or completed
+func (c *FakeCluster) MonitorJobs() {
+	logrus.WithField("cluster-name", c.Name).Info("Starting jobs monitoring routine")
+
+	for {
+		select {
+		case <-c.stopMonitoring:
+			logrus.WithField("cluster-name", c.Name).Info("Jobs monitoring routine stopped")
+			return
+		case <-time.After(fakeMonitorInterval):
+		}
+		now := utils.Now()
+		ended := false
+
+		c.runsLock.Lock()
+		for elem := range c.Jobs.Iter() {
+			job := elem.Value.(*m.Job)
+			run, ok := c.runs[job]
+			if !ok {
+				continue
+			}
+			if run.Start.IsZero() {
+				run.Start = now
+				events.PublishJob(events.JobStarted, job)
+			}
+			if now.Sub(run.Start) < run.Duration {
+				continue
+			}
+
+			if run.Fails {
+				job.Status = m.JobStatusFailed
+			} else {
+				job.Status = m.JobStatusCompleted
+			}
+			job.CheckDeadline(now)
+			persistent.Write(job)
+			if outcome, ok := job.FailureOutcome(now); ok {
+				persistent.Write(outcome)
+			}
+			events.PublishJob(events.JobFinished, job)
+			c.release(run.containers)
+			c.Jobs.MarkTombstone(elem.Index)
+			ended = true
+		}
+		c.Jobs.Sync()
+		c.runsLock.Unlock()
+
+		// The pool releases the cluster once it has been idle long enough, unless new jobs are assigned to it
+		c.Lock()
+		if ended && c.Jobs.Len() == 0 {
+			c.IdleSince = now
+		}
+		c.Unlock()
+	}
+}
+
+// StopMonitoringJobs stops the job monitoring routine, e.g. when the cluster is lost
+func (c *FakeCluster) StopMonitoringJobs() {
+	c.stopOnce.Do(func() {
+		close(c.stopMonitoring)
+	})
+}
+
+// CancelJob stops a job running on the fake cluster
+func (c *FakeCluster) CancelJob(job *m.Job) error {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	if _, ok := c.runs[job]; !ok {
+		return fmt.Errorf("job %d was never submitted to the fake cluster", job.ID)
+	}
+	for elem := range c.Jobs.Iter() {
+		if elem.Value.(*m.Job) == job {
+			c.Jobs.MarkTombstone(elem.Index)
+		}
+	}
+	c.Jobs.Sync()
+	return nil
+}
+
+// GetJobStatus returns the status of a job on the fake cluster
+func (c *FakeCluster) GetJobStatus(job *m.Job) (m.JobStatus, error) {
+	return job.Status, nil
+}
+
+// GetCost returns cluster's cost so far in dollars
+func (c *FakeCluster) GetCost() float32 {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	return c.Cost
+}
+
+// GetStatus returns cluster's status e.g. "running"
+func (c *FakeCluster) GetStatus() m.ClusterStatus {
+	return c.Status
+}
+
+// SetStatus set cluster's status e.g. "running"
+func (c *FakeCluster) SetStatus(s m.ClusterStatus) {
+	c.Status = s
+}
+
+// <-- end implementation of `ClusterBaseInterface` interface -->
+
+// appendJob adds the job to the ones of the cluster, the caller may hold the lock of the cluster
+func (c *FakeCluster) appendJob(job *m.Job) {
+	c.Jobs.Append(job)
+	// Start monitoring jobs
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	if !c.isMonitoring {
+		c.isMonitoring = true
+		go c.MonitorJobs()
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"obi/master/config"
+	"obi/master/events"
+	m "obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of the Livy batches which are told apart
+const (
+	livySuccess = "success"
+	livyDead    = "dead"
+	livyKilled  = "killed"
+	livyError   = "error"
+	livyRunning = "running"
+)
+
+func init() {
+	Register(Platform{
+		Name: "livy",
+		New: func(base *m.ClusterBase, infra config.Infrastructure, profile m.ClusterProfile) Cluster {
+			return NewLivyCluster(base, infra.Livy)
+		},
+		Validate: func(infra config.Infrastructure) []error {
+			var errs []error
+			if infra.Livy.URL == "" || infra.Livy.ResourceManagerURL == "" {
+				errs = append(errs, fmt.Errorf("livy: url and resourceManagerUrl are required"))
+			}
+			if infra.Livy.Timeout <= 0 || infra.Livy.PollInterval <= 0 {
+				errs = append(errs, fmt.Errorf("livy: timeout and pollInterval must be positive"))
+			}
+			return errs
+		},
+		// The clusters are shares of a static YARN cluster, they neither create nodes nor cost anything
+		Nodes: func(demand m.ResourceDemand, profile m.ClusterProfile) (int32, int32) {
+			return 0, 0
+		},
+		CostPerHour: func(profile m.ClusterProfile, workers, preemptible int32) float64 {
+			return 0
+		},
+		Capabilities: Capabilities{RealTime: true},
+	})
+}
+
+// livyBatch is a batch as described by the Livy REST API
+type livyBatch struct {
+	ID    int    `json:"id"`
+	AppID string `json:"appId"`
+	State string `json:"state"`
+}
+
+// livyBatchRequest is the body of the request creating a batch
+type livyBatchRequest struct {
+	File string            `json:"file"`
+	Args []string          `json:"args,omitempty"`
+	Conf map[string]string `json:"conf,omitempty"`
+	Name string            `json:"name,omitempty"`
+}
+
+// yarnClusterMetrics is the response of the cluster metrics endpoint of the YARN ResourceManager REST API
+type yarnClusterMetrics struct {
+	ClusterMetrics struct {
+		AppsSubmitted         int32 `json:"appsSubmitted"`
+		AppsCompleted         int32 `json:"appsCompleted"`
+		AppsPending           int32 `json:"appsPending"`
+		AppsRunning           int32 `json:"appsRunning"`
+		AppsFailed            int32 `json:"appsFailed"`
+		AppsKilled            int32 `json:"appsKilled"`
+		AllocatedMB           int32 `json:"allocatedMB"`
+		AvailableMB           int32 `json:"availableMB"`
+		PendingMB             int32 `json:"pendingMB"`
+		AllocatedVirtualCores int32 `json:"allocatedVirtualCores"`
+		AvailableVirtualCores int32 `json:"availableVirtualCores"`
+		PendingVirtualCores   int32 `json:"pendingVirtualCores"`
+		ContainersAllocated   int32 `json:"containersAllocated"`
+		ContainersPending     int32 `json:"containersPending"`
+		ActiveNodes           int32 `json:"activeNodes"`
+	} `json:"clusterMetrics"`
+}
+
+// livyScaleRequest is the body posted to the scale hook
+type livyScaleRequest struct {
+	Cluster        string `json:"cluster"`
+	Infrastructure string `json:"infrastructure"`
+	Delta          int32  `json:"delta"`
+}
+
+// LivyCluster is a share of a static, pre-existing YARN cluster fronted by Apache Livy. Its jobs are submitted
+// as Livy batches and its metrics are read from the ResourceManager instead of being sent as heartbeats, so
+// they describe the whole YARN cluster. Allocating and freeing it creates and deletes nothing
+type LivyCluster struct {
+	*m.ClusterBase
+	config.Livy
+	client         *http.Client
+	conf           map[string]string
+	isMonitoring   bool
+	monitorLock    sync.Mutex
+	stopMonitoring chan struct{}
+	stopOnce       sync.Once
+	quit           chan struct{}
+	quitOnce       sync.Once
+}
+
+// NewLivyCluster is the constructor of LivyCluster struct
+// @param baseInfo is the base object for a cluster
+// @param livy tells how to reach Livy and the ResourceManager of the YARN cluster
+// return the pointer to the new LivyCluster instance
+func NewLivyCluster(baseInfo *m.ClusterBase, livy config.Livy) *LivyCluster {
+	baseInfo.Platform = "livy"
+	return &LivyCluster{
+		ClusterBase:    baseInfo,
+		Livy:           livy,
+		client:         &http.Client{Timeout: time.Duration(livy.Timeout) * time.Second},
+		stopMonitoring: make(chan struct{}),
+		quit:           make(chan struct{}),
+	}
+}
+
+// call sends a JSON request and decodes the JSON response
+// @param method is the HTTP method of the request
+// @param url is the address of the resource
+// @param body is encoded as the body of the request, nothing is sent if it is nil
+// @param out receives the response, which is discarded if it is nil
+func (c *LivyCluster) call(method, url string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Livy rejects the requests changing the state without this header when CSRF protection is enabled
+	req.Header.Set("X-Requested-By", "obi")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: unexpected status %s", method, url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// batchURL returns the address of the Livy batch running the given job
+func (c *LivyCluster) batchURL(job *m.Job) string {
+	return fmt.Sprintf("%s/batches/%s", strings.TrimRight(c.URL, "/"), job.PlatformDependentID)
+}
+
+// metrics reads the metrics of the YARN cluster from the ResourceManager
+func (c *LivyCluster) metrics() (m.HeartbeatMessage, error) {
+	var metrics yarnClusterMetrics
+	url := strings.TrimRight(c.ResourceManagerURL, "/") + "/ws/v1/cluster/metrics"
+	if err := c.call(http.MethodGet, url, nil, &metrics); err != nil {
+		return m.HeartbeatMessage{}, err
+	}
+	timestamp, _ := ptypes.TimestampProto(utils.Now())
+	cm := metrics.ClusterMetrics
+	return m.HeartbeatMessage{
+		ClusterName:         c.Name,
+		AppsSubmitted:       cm.AppsSubmitted,
+		AppsRunning:         cm.AppsRunning,
+		AppsPending:         cm.AppsPending,
+		AppsCompleted:       cm.AppsCompleted,
+		AppsKilled:          cm.AppsKilled,
+		AppsFailed:          cm.AppsFailed,
+		AllocatedMB:         cm.AllocatedMB,
+		AllocatedVCores:     cm.AllocatedVirtualCores,
+		AllocatedContainers: cm.ContainersAllocated,
+		AvailableMB:         cm.AvailableMB,
+		AvailableVCores:     cm.AvailableVirtualCores,
+		PendingMB:           cm.PendingMB,
+		PendingVCores:       cm.PendingVirtualCores,
+		PendingContainers:   cm.ContainersPending,
+		Timestamp:           timestamp,
+		NumberOfNodes:       cm.ActiveNodes,
+	}, nil
+}
+
+// pollMetrics records the metrics of the YARN cluster at every poll interval in place of the heartbeats.
+// It will be stop when the `quit` channel is closed
+func (c *LivyCluster) pollMetrics() {
+	ticker := time.NewTicker(time.Duration(c.PollInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+		// Without new metrics the pool considers the cluster lost after the kill timeout
+		heartbeat, err := c.metrics()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"clusterName": c.Name,
+				"error":       err,
+			}).Warning("Unable to read the metrics of the YARN cluster")
+			continue
+		}
+		c.AddMetricsSnapshot(heartbeat)
+	}
+}
+
+// batch reads the state of the Livy batch running the given job
+func (c *LivyCluster) batch(job *m.Job) (livyBatch, error) {
+	var batch livyBatch
+	if job.PlatformDependentID == "" {
+		return batch, fmt.Errorf("job %d was never submitted to Livy", job.ID)
+	}
+	err := c.call(http.MethodGet, c.batchURL(job), nil, &batch)
+	return batch, err
+}
+
+// <-- start implementation of `Scalable` interface -->
+
+// Scale sends the scaling decision to the scale hook, if any, since the YARN cluster is not managed by OBI
+// @param delta is the number of nodes to add or remove
+func (c *LivyCluster) Scale(delta int32) bool {
+	if c.ScaleHook == "" {
+		return true
+	}
+	err := c.call(http.MethodPost, c.ScaleHook, livyScaleRequest{c.Name, c.Infrastructure, delta}, nil)
+	if err != nil {
+		logrus.WithField("error", err).Error("Scale hook call failed")
+		return false
+	}
+	logrus.WithFields(logrus.Fields{
+		"clusterName": c.Name,
+		"delta":       delta,
+	}).Info("Scaling sent to the scale hook.")
+	events.PublishCluster(events.ClusterScaled, c)
+	return false
+}
+
+// <-- end implementation of `Scalable` interface -->
+
+// <-- start implementation of `ClusterBaseInterface` interface -->
+
+// GetName is for getting the name of the cluster
+func (c *LivyCluster) GetName() string {
+	return c.Name
+}
+
+// SubmitJob is for sending a new job to Livy as a batch
+func (c *LivyCluster) SubmitJob(job *m.Job) error {
+	var batch livyBatch
+	err := c.call(http.MethodPost, strings.TrimRight(c.URL, "/")+"/batches", livyBatchRequest{
+		File: job.ExecutablePath,
+		Args: strings.Fields(job.Args),
+		Conf: c.conf,
+		Name: fmt.Sprintf("obi-%d", job.ID),
+	}, &batch)
+	if err != nil {
+		logrus.WithField("error", err).Error("Livy batch creation failed")
+		return err
+	}
+	job.PlatformDependentID = strconv.Itoa(batch.ID)
+
+	logrus.WithField("cluster", c.Name).Info("Cluster has been assigned with a new job")
+	c.appendJob(job)
+	logrus.WithField("clusterName", c.Name).Info("New job deployed")
+	return nil
+}
+
+// GetMetricsWindow is for getting last metrics of the cluster
+func (c *LivyCluster) GetMetricsWindow() *utils.ConcurrentSlice {
+	return c.GetMetrics()
+}
+
+// AddMetricsSnapshot is for updating the cluster with new metrics
+// @newMetrics is the object filled with new metrics
+func (c *LivyCluster) AddMetricsSnapshot(newMetrics m.HeartbeatMessage) {
+	c.SetMetrics(newMetrics)
+}
+
+// GetPreemptibleNodes returns no node, since the YARN cluster is not resized by OBI
+func (c *LivyCluster) GetPreemptibleNodes() int32 {
+	return 0
+}
+
+// AllocateResources checks that the YARN cluster is reachable and starts reading its metrics
+// @param profile gives the Spark properties of the jobs, the ones prefixed by "spark:"
+func (c *LivyCluster) AllocateResources(profile m.ClusterProfile) error {
+	c.conf = make(map[string]string)
+	for key, value := range profile.Properties {
+		if strings.HasPrefix(key, "spark:") {
+			c.conf[strings.TrimPrefix(key, "spark:")] = value
+		}
+	}
+	c.CreationTimestamp = utils.Now()
+	events.PublishCluster(events.ClusterCreating, c)
+
+	heartbeat, err := c.metrics()
+	if err != nil {
+		logrus.WithField("error", err).Error("Unable to reach the ResourceManager of the YARN cluster")
+		return err
+	}
+	c.AddMetricsSnapshot(heartbeat)
+
+	c.Status = m.ClusterStatusRunning
+	logrus.WithField("name", c.Name).Info("New cluster on Livy platform")
+	events.PublishCluster(events.ClusterRunning, c)
+	persistent.Write(c)
+
+	go c.pollMetrics()
+	return nil
+}
+
+// FreeResources stops using the YARN cluster, which is left as it is
+func (c *LivyCluster) FreeResources() error {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+	})
+	c.StopMonitoringJobs()
+
+	c.Status = m.ClusterStatusClosed
+	persistent.Write(c)
+	events.PublishCluster(events.ClusterDeleted, c)
+	logrus.WithField("name", c.Name).Info("Released cluster on Livy platform")
+
+	return nil
+}
+
+// GetAllocatedJobSlots returns the number of jobs the cluster is currently handling
+func (c *LivyCluster) GetAllocatedJobSlots() int {
+	return c.Jobs.Len()
+}
+
+// GetPlatform returns cluster's platform type i.e. "livy"
+func (c *LivyCluster) GetPlatform() string {
+	return c.Platform
+}
+
+// GetCreationTimestamp return cluster's creation timestamp
+func (c *LivyCluster) GetCreationTimestamp() time.Time {
+	return c.CreationTimestamp
+}
+
+// MonitorJobs track the state of the batches of the jobs
+func (c *LivyCluster) MonitorJobs() {
+	logrus.WithField("cluster-name", c.Name).Info("Starting jobs monitoring routine")
+
+	// Jobs already seen running by Livy
+	started := make(map[*m.Job]bool)
+
+	for {
+		select {
+		case <-c.stopMonitoring:
+			logrus.WithField("cluster-name", c.Name).Info("Jobs monitoring routine stopped")
+			return
+		case <-time.After(time.Duration(c.PollInterval) * time.Second):
+		}
+		ended := false
+		for elem := range c.Jobs.Iter() {
+			job := elem.Value.(*m.Job)
+			batch, err := c.batch(job)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"jobID": job.ID,
+					"error": err,
+				}).Warning("Unable to read the state of the Livy batch")
+				continue
+			}
+
+			if batch.State == livyRunning && !started[job] {
+				started[job] = true
+				events.PublishJob(events.JobStarted, job)
+			}
+
+			status, done := livyJobStatus(batch.State)
+			if !done {
+				continue
+			}
+
+			// Update job in persistent store if its state changed
+			previousState := job.Status
+			job.Status = status
+			job.CheckDeadline(time.Now())
+			if previousState != job.Status {
+				persistent.Write(job)
+				if outcome, ok := job.FailureOutcome(time.Now()); ok {
+					persistent.Write(outcome)
+				}
+				events.PublishJob(events.JobFinished, job)
+			}
+			delete(started, job)
+
+			// Drop job from the cluster's jobs list
+			c.Jobs.MarkTombstone(elem.Index)
+			ended = true
+		}
+		// Force synchronization between tombstone markers and concurrent slice
+		c.Jobs.Sync()
+		// The pool releases the cluster once it has been idle long enough, unless new jobs are assigned to it
+		c.Lock()
+		if ended && c.Jobs.Len() == 0 {
+			c.IdleSince = utils.Now()
+		}
+		c.Unlock()
+	}
+}
+
+// StopMonitoringJobs stops the job monitoring routine, e.g. when the cluster is lost
+func (c *LivyCluster) StopMonitoringJobs() {
+	c.stopOnce.Do(func() {
+		close(c.stopMonitoring)
+	})
+}
+
+// CancelJob deletes the Livy batch of a job, which kills its YARN application
+func (c *LivyCluster) CancelJob(job *m.Job) error {
+	if job.PlatformDependentID == "" {
+		return fmt.Errorf("job %d was never submitted to Livy", job.ID)
+	}
+	if err := c.call(http.MethodDelete, c.batchURL(job), nil, nil); err != nil {
+		logrus.WithField("error", err).Error("Livy batch deletion failed")
+		return err
+	}
+	return nil
+}
+
+// GetJobStatus returns the status of a job according to the state of its Livy batch
+func (c *LivyCluster) GetJobStatus(job *m.Job) (m.JobStatus, error) {
+	batch, err := c.batch(job)
+	if err != nil {
+		return job.Status, err
+	}
+	status, _ := livyJobStatus(batch.State)
+	return status, nil
+}
+
+// GetCost returns no cost, since the YARN cluster is static and shared by all the clusters of the infrastructure
+func (c *LivyCluster) GetCost() float32 {
+	return 0
+}
+
+// GetStatus returns cluster's status e.g. "running"
+func (c *LivyCluster) GetStatus() m.ClusterStatus {
+	return c.Status
+}
+
+// SetStatus set cluster's status e.g. "running"
+func (c *LivyCluster) SetStatus(s m.ClusterStatus) {
+	c.Status = s
+}
+
+// <-- end implementation of `ClusterBaseInterface` interface -->
+
+// appendJob adds the job to the ones of the cluster, the caller may hold the lock of the cluster
+func (c *LivyCluster) appendJob(job *m.Job) {
+	c.Jobs.Append(job)
+	// Start monitoring jobs
+	c.monitorLock.Lock()
+	defer c.monitorLock.Unlock()
+	if !c.isMonitoring {
+		c.isMonitoring = true
+		go c.MonitorJobs()
+	}
+}
+
+// livyJobStatus maps the state of a Livy batch to the status of its job
+// return the status, true if the batch ended
+func livyJobStatus(state string) (m.JobStatus, bool) {
+	switch state {
+	case livySuccess:
+		return m.JobStatusCompleted, true
+	case livyDead, livyKilled, livyError:
+		return m.JobStatusFailed, true
+	default:
+		return m.JobStatusRunning, false
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"net/http/httptest"
+	"obi/master/config"
+	m "obi/master/model"
+	"obi/master/platforms/livystub"
+	"testing"
+	"time"
+)
+
+// newTestLivyCluster returns a cluster allocated on a stub of Livy and of the ResourceManager. The batches
+// are only checked on demand, the monitoring routine waiting for longer than any test
+func newTestLivyCluster(t *testing.T, options livystub.Options) (*LivyCluster, *livystub.Server, func()) {
+	stub := livystub.New(options)
+	server := httptest.NewServer(stub.Handler())
+	cluster := NewLivyCluster(m.NewClusterBase("livy-test", 0, "livy", "", 0), config.Livy{
+		URL:                server.URL,
+		ResourceManagerURL: server.URL,
+		Timeout:            5,
+		PollInterval:       3600,
+	})
+	profile := m.ClusterProfile{Properties: map[string]string{
+		"spark:spark.executor.memory": "2g",
+		"yarn:yarn.nodemanager.vmem":  "false",
+	}}
+	if err := cluster.AllocateResources(profile); err != nil {
+		server.Close()
+		t.Fatalf("allocation failed: %v", err)
+	}
+	return cluster, stub, func() {
+		cluster.FreeResources()
+		server.Close()
+	}
+}
+
+func TestLivySubmitStatusAndKill(t *testing.T) {
+	cluster, stub, stop := newTestLivyCluster(t, livystub.Options{
+		Duration:   time.Hour,
+		Containers: 3,
+		Nodes:      2,
+		NodeMB:     8192,
+		NodeVCores: 4,
+	})
+	defer stop()
+
+	if got := cluster.conf; len(got) != 1 || got["spark.executor.memory"] != "2g" {
+		t.Errorf("Spark properties of the batches: got %v", got)
+	}
+
+	job := &m.Job{ID: 7, ExecutablePath: "gs://bucket/job.py", Args: "--day 2018-01-01"}
+	if err := cluster.SubmitJob(job); err != nil {
+		t.Fatalf("submission failed: %v", err)
+	}
+	if job.PlatformDependentID != "1" {
+		t.Errorf("batch of the job: got %q, want \"1\"", job.PlatformDependentID)
+	}
+	if got := stub.File(1); got != job.ExecutablePath {
+		t.Errorf("submitted file: got %q, want %q", got, job.ExecutablePath)
+	}
+	if cluster.GetAllocatedJobSlots() != 1 {
+		t.Errorf("job slots: got %d, want 1", cluster.GetAllocatedJobSlots())
+	}
+
+	status, err := cluster.GetJobStatus(job)
+	if err != nil || status != m.JobStatusRunning {
+		t.Errorf("status of the running batch: got %v, %v", status, err)
+	}
+
+	if err := cluster.CancelJob(job); err != nil {
+		t.Fatalf("kill failed: %v", err)
+	}
+	status, err = cluster.GetJobStatus(job)
+	if err != nil || status != m.JobStatusFailed {
+		t.Errorf("status of the killed batch: got %v, %v", status, err)
+	}
+
+	never := &m.Job{ID: 8}
+	if err := cluster.CancelJob(never); err == nil {
+		t.Error("killing a job never submitted should fail")
+	}
+	if _, err := cluster.GetJobStatus(never); err == nil {
+		t.Error("reading the status of a job never submitted should fail")
+	}
+}
+
+func TestLivyBatchEnd(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failRate float64
+		want     m.JobStatus
+	}{
+		{"success", 0, m.JobStatusCompleted},
+		{"dead", 1, m.JobStatusFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster, _, stop := newTestLivyCluster(t, livystub.Options{
+				FailRate:   tc.failRate,
+				Containers: 1,
+				Nodes:      1,
+				NodeMB:     4096,
+				NodeVCores: 4,
+			})
+			defer stop()
+
+			job := &m.Job{ID: 1, ExecutablePath: "gs://bucket/job.py"}
+			if err := cluster.SubmitJob(job); err != nil {
+				t.Fatalf("submission failed: %v", err)
+			}
+			status, err := cluster.GetJobStatus(job)
+			if err != nil || status != tc.want {
+				t.Errorf("status of the ended batch: got %v, %v, want %v", status, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLivyResourceManagerMetrics(t *testing.T) {
+	cluster, _, stop := newTestLivyCluster(t, livystub.Options{
+		Duration:   time.Hour,
+		Containers: 3,
+		Nodes:      2,
+		NodeMB:     8192,
+		NodeVCores: 4,
+	})
+	defer stop()
+
+	// The allocation records the metrics of the idle YARN cluster
+	if cluster.GetMetricsWindow().Len() != 1 {
+		t.Fatalf("metrics recorded at the allocation: got %d, want 1", cluster.GetMetricsWindow().Len())
+	}
+	idle, _ := m.LastMetrics(cluster.GetMetricsWindow())
+	if idle.ClusterName != "livy-test" || idle.NumberOfNodes != 2 || idle.AvailableVCores != 8 ||
+		idle.AvailableMB != 16384 || idle.AllocatedContainers != 0 {
+		t.Errorf("metrics of the idle cluster: got %+v", idle)
+	}
+
+	// Three running batches of three containers ask for one more container than the eight cores
+	for id := 1; id <= 3; id++ {
+		if err := cluster.SubmitJob(&m.Job{ID: id, ExecutablePath: "gs://bucket/job.py"}); err != nil {
+			t.Fatalf("submission failed: %v", err)
+		}
+	}
+	busy, err := cluster.metrics()
+	if err != nil {
+		t.Fatalf("metrics failed: %v", err)
+	}
+	for _, field := range []struct {
+		name      string
+		got, want int32
+	}{
+		{"apps submitted", busy.AppsSubmitted, 3},
+		{"apps running", busy.AppsRunning, 3},
+		{"allocated MB", busy.AllocatedMB, 16384},
+		{"allocated vcores", busy.AllocatedVCores, 8},
+		{"allocated containers", busy.AllocatedContainers, 8},
+		{"available vcores", busy.AvailableVCores, 0},
+		{"pending MB", busy.PendingMB, 2048},
+		{"pending vcores", busy.PendingVCores, 1},
+		{"pending containers", busy.PendingContainers, 1},
+		{"nodes", busy.NumberOfNodes, 2},
+	} {
+		if field.got != field.want {
+			t.Errorf("%s of the busy cluster: got %d, want %d", field.name, field.got, field.want)
+		}
+	}
+	if busy.Timestamp == nil {
+		t.Error("metrics of the busy cluster have no timestamp")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+// Package livystub serves the few endpoints of the Livy and of the YARN ResourceManager REST APIs used by the
+// "livy" platform, so that the platform can be run and tested without a YARN cluster. Every batch runs for a
+// fixed time, fails with a given probability and takes the same number of containers.
+package livystub
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options describes the batches and the YARN cluster served by the stub
+type Options struct {
+	// Duration is the time taken by every batch
+	Duration time.Duration
+	// FailRate is the probability of a batch to fail
+	FailRate float64
+	// Containers is the number of containers taken by every running batch
+	Containers int32
+	// Nodes is the number of nodes of the YARN cluster
+	Nodes int32
+	// NodeMB is the memory of each node
+	NodeMB int32
+	// NodeVCores is the number of virtual cores of each node
+	NodeVCores int32
+}
+
+// batch is a Livy batch with the execution decided at its submission
+type batch struct {
+	ID     int    `json:"id"`
+	AppID  string `json:"appId"`
+	State  string `json:"state"`
+	file   string
+	start  time.Time
+	fails  bool
+	killed bool
+}
+
+// Server holds the batches submitted so far and the shape of the YARN cluster
+type Server struct {
+	Options
+	batches map[int]*batch
+	nextID  int
+	sync.Mutex
+}
+
+// New is the constructor of Server struct
+// @param options describes the batches and the YARN cluster to serve
+// return the pointer to the new Server instance
+func New(options Options) *Server {
+	return &Server{
+		Options: options,
+		batches: make(map[int]*batch),
+	}
+}
+
+// Handler returns the handler serving both the Livy and the ResourceManager endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/batches", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.createBatch(w, r)
+	})
+	mux.HandleFunc("/batches/", s.handleBatch)
+	mux.HandleFunc("/ws/v1/cluster/metrics", s.clusterMetrics)
+	return mux
+}
+
+// File returns the executable submitted with the batch, empty if there is no such batch
+// @param id is the identifier of the batch
+func (s *Server) File(id int) string {
+	s.Lock()
+	defer s.Unlock()
+	if b, ok := s.batches[id]; ok {
+		return b.file
+	}
+	return ""
+}
+
+// refresh updates the state of the batch according to the time it has run. It must be called holding the lock
+func (s *Server) refresh(b *batch) {
+	switch {
+	case b.killed:
+		b.State = "killed"
+	case time.Since(b.start) < s.Duration:
+		b.State = "running"
+	case b.fails:
+		b.State = "dead"
+	default:
+		b.State = "success"
+	}
+}
+
+// csrfProtected rejects the requests changing the state without the header, like Livy with CSRF protection
+func csrfProtected(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-Requested-By") == "" {
+		http.Error(w, "missing X-Requested-By header", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) createBatch(w http.ResponseWriter, r *http.Request) {
+	if !csrfProtected(w, r) {
+		return
+	}
+	var req struct {
+		File string `json:"file"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.File == "" {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.nextID++
+	b := &batch{
+		ID:    s.nextID,
+		AppID: fmt.Sprintf("application_%d_%04d", time.Now().Unix(), s.nextID),
+		file:  req.File,
+		start: time.Now(),
+		fails: rand.Float64() < s.FailRate,
+	}
+	s.refresh(b)
+	s.batches[b.ID] = b
+	logrus.WithFields(logrus.Fields{
+		"batch": b.ID,
+		"file":  req.File,
+	}).Info("Batch submitted")
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/batches/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.batches[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.refresh(b)
+		writeJSON(w, http.StatusOK, b)
+	case http.MethodDelete:
+		if !csrfProtected(w, r) {
+			return
+		}
+		if b.State == "running" {
+			b.killed = true
+		}
+		s.refresh(b)
+		logrus.WithField("batch", b.ID).Info("Batch deleted")
+		writeJSON(w, http.StatusOK, map[string]string{"msg": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// clusterMetrics describes the YARN cluster as the ResourceManager would, every running batch asking for the
+// same number of one-core containers
+func (s *Server) clusterMetrics(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	counts := make(map[string]int32)
+	for _, b := range s.batches {
+		s.refresh(b)
+		counts[b.State]++
+	}
+	capacity := s.Nodes * s.NodeVCores
+	containerMB := s.NodeMB / s.NodeVCores
+	demand := counts["running"] * s.Containers
+	allocated := int32(math.Min(float64(demand), float64(capacity)))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"clusterMetrics": map[string]int32{
+			"appsSubmitted":         int32(len(s.batches)),
+			"appsCompleted":         counts["success"],
+			"appsRunning":           counts["running"],
+			"appsFailed":            counts["dead"],
+			"appsKilled":            counts["killed"],
+			"allocatedMB":           allocated * containerMB,
+			"availableMB":           (capacity - allocated) * containerMB,
+			"pendingMB":             (demand - allocated) * containerMB,
+			"allocatedVirtualCores": allocated,
+			"availableVirtualCores": capacity - allocated,
+			"pendingVirtualCores":   demand - allocated,
+			"containersAllocated":   allocated,
+			"containersPending":     demand - allocated,
+			"activeNodes":           s.Nodes,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"fmt"
+	"obi/master/config"
+	m "obi/master/model"
+	"sort"
+)
+
+// Cluster is a cluster of any platform, which can be resized by an autoscaler
+type Cluster interface {
+	m.ClusterBaseInterface
+	m.Scalable
+}
+
+// Capabilities describes what the clusters of a platform support
+type Capabilities struct {
+	// Heartbeats tells whether the clusters send heartbeats to the heartbeat receiver of the master
+	Heartbeats bool
+	// Listable tells whether the clusters existing on the platform can be listed, so that the reconciler
+	// compares them with the pool and the database
+	Listable bool
+	// RealTime tells whether the clusters run on the real clock, so that their autoscalers run on their own.
+	// The clusters of the other platforms are driven by the simulator and cannot be used by an infrastructure
+	RealTime bool
+}
+
+// Platform describes how the clusters of a platform are created and found
+type Platform struct {
+	// Name is the name the platform is configured with, e.g. "dataproc"
+	Name string
+	// New creates a cluster whose resources are not allocated yet
+	New func(base *m.ClusterBase, infra config.Infrastructure, profile m.ClusterProfile) Cluster
+	// Existing builds a cluster whose resources are already allocated, nil if clusters cannot be adopted
+	Existing func(infra config.Infrastructure, clusterName string) (m.ClusterBaseInterface, error)
+	// List returns the names of the clusters created by OBI which exist in the infrastructure, only needed
+	// by listable platforms
+	List func(infra config.Infrastructure) ([]string, error)
+	// Configure applies the settings of the platform read from the configuration, nil if it has none
+	Configure func(c *config.Config)
+	// Validate checks the settings of an infrastructure of the platform, nil if it has none
+	Validate func(infra config.Infrastructure) []error
+	// Nodes computes the number of primary and of preemptible workers of a new cluster hosting the given
+	// demand. If nil, the clusters are created with the workers of their profile
+	Nodes func(demand m.ResourceDemand, profile m.ClusterProfile) (int32, int32)
+	// CostPerHour estimates the hourly cost of a cluster with the given nodes, which is checked against the
+	// spending limits. If nil, the nodes cost what the profile says
+	CostPerHour  func(profile m.ClusterProfile, workers, preemptible int32) float64
+	Capabilities Capabilities
+}
+
+// ProfileNodes returns the workers a cluster is created with according to its profile, at least the minimum
+// number of preemptible workers
+// @param profile is the profile of the cluster
+func ProfileNodes(profile m.ClusterProfile) (int32, int32) {
+	preemptible := profile.PreemptibleNodes
+	if preemptible < profile.MinPreemptibleNodes {
+		preemptible = profile.MinPreemptibleNodes
+	}
+	return profile.WorkerNodes, preemptible
+}
+
+// ProfileCostPerHour returns the hourly cost of the given nodes according to the costs of the profile
+// @param profile gives the hourly cost of each node and the fee of the platform for each node
+// @param workers is the number of primary workers
+// @param preemptible is the number of preemptible workers
+func ProfileCostPerHour(profile m.ClusterProfile, workers, preemptible int32) float64 {
+	return float64(workers)*(profile.NodeCostPerHour+profile.PlatformCostPerHour) +
+		float64(preemptible)*(profile.PreemptibleNodeCostPerHour+profile.PlatformCostPerHour)
+}
+
+// registry holds the platforms by name, they register themselves at package initialization
+var registry = make(map[string]Platform)
+
+// Register adds a platform to the ones clusters can be created on, it is meant to be called at
+// package initialization
+// @param p is the platform to add, its name must not be already registered
+func Register(p Platform) {
+	if _, ok := registry[p.Name]; ok {
+		panic(fmt.Sprintf("platform '%s' registered twice", p.Name))
+	}
+	if p.Nodes == nil {
+		p.Nodes = func(demand m.ResourceDemand, profile m.ClusterProfile) (int32, int32) {
+			return ProfileNodes(profile)
+		}
+	}
+	if p.CostPerHour == nil {
+		p.CostPerHour = ProfileCostPerHour
+	}
+	registry[p.Name] = p
+}
+
+// Get returns the platform with the given name
+// @param name is the name of the platform, e.g. "dataproc"
+// return the platform, false if no platform has the given name
+func Get(name string) (Platform, bool) {
+	p, ok := registry[name]
+	return p, ok
+}
+
+// Names returns the names of the registered platforms in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configure applies the configuration to every platform
+// @param c is the configuration read at startup
+func Configure(c *config.Config) {
+	for _, p := range registry {
+		if p.Configure != nil {
+			p.Configure(c)
+		}
+	}
+}
+
+func init() {
+	config.AddValidator(func(c *config.Config) []error {
+		var errs []error
+		for _, name := range c.InfrastructureNames() {
+			infra := c.Infrastructures[name]
+			p, ok := Get(infra.Platform)
+			if !ok {
+				errs = append(errs, fmt.Errorf("infrastructures.%s.platform: unknown platform '%s'", name, infra.Platform))
+			} else if !p.Capabilities.RealTime {
+				errs = append(errs, fmt.Errorf("infrastructures.%s.platform: platform '%s' can only be used by the simulator",
+					name, infra.Platform))
+			} else if p.Validate != nil {
+				for _, err := range p.Validate(infra) {
+					errs = append(errs, fmt.Errorf("infrastructures.%s.%s", name, err))
+				}
+			}
+		}
+		return errs
+	})
+}
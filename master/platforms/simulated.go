@@ -0,0 +1,361 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/events"
+	m "obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// SimulationConfig describes how the simulated platform behaves
+type SimulationConfig struct {
+	config.Simulation
+	// Runtime returns how long the job takes when it gets all the containers it asks for.
+	// If it is not set the predicted duration of the job is used
+	Runtime func(job *m.Job) time.Duration
+}
+
+// Simulation is the configuration of the simulated platform, to be set before any simulated cluster is created
+var Simulation = SimulationConfig{
+	Simulation: config.Simulation{
+		ProvisioningTime:     120,
+		ContainerMemoryMB:    2048,
+		DefaultJobContainers: 4,
+	},
+}
+
+func init() {
+	Register(Platform{
+		Name: "simulated",
+		New: func(base *m.ClusterBase, infra config.Infrastructure, profile m.ClusterProfile) Cluster {
+			return NewSimulatedCluster(base, profile.MinPreemptibleNodes)
+		},
+		Configure: func(c *config.Config) {
+			Simulation.Simulation = c.Simulation
+		},
+		// The simulated clusters stand for Dataproc clusters, so they are sized the same way
+		Nodes: dataprocNodesForDemand,
+	})
+}
+
+// simulatedClusters keeps every simulated cluster ever created, also after it was released
+var simulatedClusters struct {
+	clusters []*SimulatedCluster
+	sync.Mutex
+}
+
+// SimulatedClusters returns all the simulated clusters created so far
+func SimulatedClusters() []*SimulatedCluster {
+	simulatedClusters.Lock()
+	defer simulatedClusters.Unlock()
+	return append([]*SimulatedCluster(nil), simulatedClusters.clusters...)
+}
+
+// SimulatedRun tracks the execution of a job on a simulated cluster
+type SimulatedRun struct {
+	Job *m.Job
+	// Submission is when the job was submitted to the cluster
+	Submission time.Time
+	Start time.Time
+	End time.Time
+	// Runtime is how long the job takes when it gets all the containers it asks for
+	Runtime time.Duration
+	// progress is the amount of work done so far, measured as time spent running at full speed
+	progress time.Duration
+	containers int32
+}
+
+// SimulatedCluster is a cluster which only exists on the clock of the simulator. Its jobs progress
+// when the cluster is stepped, slowing down when they ask for more containers than the cluster has.
+// Its workers have the resources and the costs of the machines of its profile
+type SimulatedCluster struct {
+	*m.ClusterBase
+	yarnModel
+	ReadyTimestamp time.Time
+	EndTimestamp time.Time
+	lastStep time.Time
+	runs map[*m.Job]*SimulatedRun
+	runsLock sync.Mutex
+}
+
+// NewSimulatedCluster is the constructor of SimulatedCluster struct
+// @param baseInfo is the base object for a cluster
+// @param preemptibleNodes is the minimum number of preemptible workers of the cluster
+// return the pointer to the new SimulatedCluster instance
+func NewSimulatedCluster(baseInfo *m.ClusterBase, preemptibleNodes int32) *SimulatedCluster {
+	baseInfo.Platform = "simulated"
+	cluster := &SimulatedCluster{
+		ClusterBase: baseInfo,
+		yarnModel:   newYarnModel(preemptibleNodes, Simulation.ContainerMemoryMB, Simulation.DefaultJobContainers),
+		runs:        make(map[*m.Job]*SimulatedRun),
+	}
+
+	simulatedClusters.Lock()
+	simulatedClusters.clusters = append(simulatedClusters.clusters, cluster)
+	simulatedClusters.Unlock()
+
+	return cluster
+}
+
+// Runs returns the executions of all the jobs submitted to the cluster
+func (c *SimulatedCluster) Runs() []*SimulatedRun {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	runs := make([]*SimulatedRun, 0, len(c.runs))
+	for _, run := range c.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Hours returns for how many hours the cluster has been allocated, up to the given time if it is still running
+func (c *SimulatedCluster) Hours(now time.Time) float64 {
+	end := c.EndTimestamp
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(c.CreationTimestamp).Hours()
+}
+
+// Step advances the cluster up to the given time: it accounts the cost of the workers, makes progress
+// on the running jobs and records a heartbeat. The pool releases the cluster once it has been idle long enough
+// @param now is the current time of the simulation
+func (c *SimulatedCluster) Step(now time.Time) {
+	if c.Status == m.ClusterStatusClosed {
+		return
+	}
+	elapsed := now.Sub(c.lastStep)
+	from := c.lastStep
+	c.lastStep = now
+
+	c.Cost += c.cost(c.WorkerNodes, elapsed)
+	if now.Before(c.ReadyTimestamp) {
+		return
+	}
+	if from.Before(c.ReadyTimestamp) {
+		from = c.ReadyTimestamp
+		events.PublishCluster(events.ClusterRunning, c)
+	}
+
+	capacity := c.capacity(c.WorkerNodes)
+
+	c.runsLock.Lock()
+	var demand int32
+	for elem := range c.Jobs.Iter() {
+		demand += c.runs[elem.Value.(*m.Job)].containers
+	}
+
+	// Containers are shared evenly, so every job runs at the same fraction of its full speed
+	rate := 1.0
+	if demand > capacity {
+		rate = float64(capacity) / float64(demand)
+	}
+
+	ended := false
+
+	for elem := range c.Jobs.Iter() {
+		run := c.runs[elem.Value.(*m.Job)]
+		start := from
+		if run.Start.IsZero() {
+			run.Start = run.Submission
+			if run.Start.Before(c.ReadyTimestamp) {
+				run.Start = c.ReadyTimestamp
+			}
+			events.PublishJob(events.JobStarted, run.Job)
+		}
+		if start.Before(run.Start) {
+			start = run.Start
+		}
+		run.progress += time.Duration(float64(now.Sub(start)) * rate)
+		if run.progress < run.Runtime {
+			continue
+		}
+
+		// Place the end of the job within the last step according to the work it had left
+		run.End = now.Add(-time.Duration(float64(run.progress-run.Runtime) / rate))
+		run.Job.Status = m.JobStatusCompleted
+		run.Job.CheckDeadline(run.End)
+		persistent.Write(run.Job)
+		if outcome, ok := run.Job.FailureOutcome(run.End); ok {
+			persistent.Write(outcome)
+		}
+		events.PublishJob(events.JobFinished, run.Job)
+		c.release(run.containers)
+		c.Jobs.MarkTombstone(elem.Index)
+		ended = true
+	}
+	c.Jobs.Sync()
+	c.runsLock.Unlock()
+
+	c.AddMetricsSnapshot(c.heartbeat(c.Name, c.WorkerNodes, int32(c.Jobs.Len()), demand, c.Cost, now))
+
+	c.Lock()
+	if ended && c.Jobs.Len() == 0 {
+		c.IdleSince = now
+	}
+	c.Unlock()
+}
+
+// <-- start implementation of `Scalable` interface -->
+
+// Scale changes the number of preemptible workers of the cluster, new workers are available immediately
+// @param delta is the number of nodes to add or remove
+func (c *SimulatedCluster) Scale(delta int32) bool {
+	if !c.scale(delta) {
+		return true
+	}
+	logrus.WithFields(logrus.Fields{
+		"clusterName":       c.Name,
+		"additionalWorkers": c.PreemptibleNodes,
+	}).Debug("Scaled simulated cluster")
+	events.PublishCluster(events.ClusterScaled, c)
+
+	return c.PreemptibleNodes == 0
+}
+
+// <-- end implementation of `Scalable` interface -->
+
+// <-- start implementation of `ClusterBaseInterface` interface -->
+
+// GetName is for getting the name of the cluster
+func (c *SimulatedCluster) GetName() string {
+	return c.Name
+}
+
+// SubmitJob is for queueing a new job on the simulated cluster
+func (c *SimulatedCluster) SubmitJob(job *m.Job) error {
+	runtime := time.Duration(job.PredictedDuration) * time.Second
+	if Simulation.Runtime != nil {
+		runtime = Simulation.Runtime(job)
+	}
+
+	c.runsLock.Lock()
+	c.runs[job] = &SimulatedRun{
+		Job:        job,
+		Submission: utils.Now(),
+		Runtime:    runtime,
+		containers: c.jobContainers(job),
+	}
+	c.runsLock.Unlock()
+	c.Jobs.Append(job)
+
+	return nil
+}
+
+// GetMetricsWindow returns the metrics of the cluster in the last heartbeats
+func (c *SimulatedCluster) GetMetricsWindow() *utils.ConcurrentSlice {
+	return c.GetMetrics()
+}
+
+// AddMetricsSnapshot adds a new heartbeat to the metrics window of the cluster
+func (c *SimulatedCluster) AddMetricsSnapshot(newMetrics m.HeartbeatMessage) {
+	c.SetMetrics(newMetrics)
+}
+
+// GetPreemptibleNodes returns the number of preemptible workers of the cluster
+func (c *SimulatedCluster) GetPreemptibleNodes() int32 {
+	return c.PreemptibleNodes
+}
+
+// AllocateResources starts the provisioning of the simulated cluster, which becomes able to run jobs
+// once the provisioning time has passed on the simulation clock
+// @param profile describes the size of the cluster and the resources and costs of its workers
+func (c *SimulatedCluster) AllocateResources(profile m.ClusterProfile) error {
+	c.WorkerNodes = c.allocate(profile, c.WorkerNodes)
+	c.CreationTimestamp = utils.Now()
+	c.ReadyTimestamp = c.CreationTimestamp.Add(time.Duration(Simulation.ProvisioningTime) * time.Second)
+	c.lastStep = c.CreationTimestamp
+	c.Status = m.ClusterStatusRunning
+	persistent.Write(c)
+	events.PublishCluster(events.ClusterCreating, c)
+
+	return nil
+}
+
+// FreeResources releases the simulated cluster
+func (c *SimulatedCluster) FreeResources() error {
+	c.Status = m.ClusterStatusClosed
+	c.EndTimestamp = utils.Now()
+	persistent.Write(c)
+	events.PublishCluster(events.ClusterDeleted, c)
+	logrus.WithField("name", c.Name).Debug("Released simulated cluster")
+
+	return nil
+}
+
+// GetAllocatedJobSlots returns the number of jobs the cluster is currently handling
+func (c *SimulatedCluster) GetAllocatedJobSlots() int {
+	return c.Jobs.Len()
+}
+
+// GetPlatform returns cluster's platform type i.e. "simulated"
+func (c *SimulatedCluster) GetPlatform() string {
+	return c.Platform
+}
+
+// GetCreationTimestamp return cluster's creation timestamp
+func (c *SimulatedCluster) GetCreationTimestamp() time.Time {
+	return c.CreationTimestamp
+}
+
+// MonitorJobs does nothing, since jobs progress when the cluster is stepped
+func (c *SimulatedCluster) MonitorJobs() {}
+
+// StopMonitoringJobs does nothing, since jobs progress when the cluster is stepped
+func (c *SimulatedCluster) StopMonitoringJobs() {}
+
+// CancelJob stops a job running on the simulated cluster
+func (c *SimulatedCluster) CancelJob(job *m.Job) error {
+	c.runsLock.Lock()
+	defer c.runsLock.Unlock()
+	if run, ok := c.runs[job]; ok && run.End.IsZero() {
+		run.End = utils.Now()
+	}
+	for elem := range c.Jobs.Iter() {
+		if elem.Value.(*m.Job) == job {
+			c.Jobs.MarkTombstone(elem.Index)
+		}
+	}
+	c.Jobs.Sync()
+	return nil
+}
+
+// GetJobStatus returns the status of a job according to the simulation
+func (c *SimulatedCluster) GetJobStatus(job *m.Job) (m.JobStatus, error) {
+	return job.Status, nil
+}
+
+// GetCost returns cluster's cost so far in dollars
+func (c *SimulatedCluster) GetCost() float32 {
+	return c.Cost
+}
+
+// GetStatus returns cluster's status e.g. "running"
+func (c *SimulatedCluster) GetStatus() m.ClusterStatus {
+	return c.Status
+}
+
+// SetStatus set cluster's status e.g. "running"
+func (c *SimulatedCluster) SetStatus(s m.ClusterStatus) {
+	c.Status = s
+}
+
+// <-- end implementation of `ClusterBaseInterface` interface -->
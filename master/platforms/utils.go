@@ -15,6 +15,7 @@
 package platforms
 
 import (
+	"obi/master/config"
 	"obi/master/model"
 		"github.com/sirupsen/logrus"
 		"fmt"
@@ -22,24 +23,24 @@ import (
 
 // NewExistingCluster is a factory method to create one of the many platform instances when the resources are already
 // allocated into the platform (e.g. Google Cloud, AWS, Azure)
-// @param platform is the name of the cloud service
+// @param infra is the infrastructure the cluster belongs to, telling its cloud service and location
 // @param clusterName is the name of the existing cluster inside that specific platform
-func NewExistingCluster(platform string, clusterName string) (model.ClusterBaseInterface, error) {
-	var newCluster model.ClusterBaseInterface
-	var err error
+func NewExistingCluster(infra config.Infrastructure, clusterName string) (model.ClusterBaseInterface, error) {
+	platform, ok := Get(infra.Platform)
+	if !ok || platform.Existing == nil {
+		logrus.WithField("platform", infra.Platform).Error("Platform unknown")
+		return nil, fmt.Errorf("impossible to create a new cluster for type '%s'", infra.Platform)
+	}
+	return platform.Existing(infra, clusterName)
+}
 
-	switch platform {
-	case "dataproc":
-		// TODO: Define config variables for Google Dataproc.
-		newCluster, err = NewExistingDataprocCluster(
-			"dhg-data-intelligence-ops",
-			"global",
-			"europe-west3-b",
-			clusterName,
-		)
-	default:
-		logrus.WithField("platform", platform).Error("Platform unknown")
-		return nil, fmt.Errorf("impossible to create a new cluster for type '%s'", platform)
+// ListClusters returns the names of the clusters created by OBI which currently exist in the given infrastructure
+// @param infra is the infrastructure, telling its cloud service and location
+func ListClusters(infra config.Infrastructure) ([]string, error) {
+	platform, ok := Get(infra.Platform)
+	if !ok || !platform.Capabilities.Listable {
+		logrus.WithField("platform", infra.Platform).Error("Platform unknown")
+		return nil, fmt.Errorf("impossible to list the clusters of type '%s'", infra.Platform)
 	}
-	return newCluster, err
+	return platform.List(infra)
 }
@@ -0,0 +1,133 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package platforms
+
+import (
+	"github.com/golang/protobuf/ptypes"
+	"math"
+	m "obi/master/model"
+	"time"
+)
+
+// yarnModel is the model of the workers and of the YARN containers shared by the in-memory clusters of the
+// simulated and of the fake platforms. The workers have the resources and the costs of the machines of the
+// cluster profile, and every job asks for a number of one-core containers which are granted as long as the
+// workers have room for them. It does not lock anything, the clusters guard it as they guard their size
+type yarnModel struct {
+	profile             m.ClusterProfile
+	containerMemoryMB   int32
+	defaultContainers   int32
+	MinPreemptibleNodes int32
+	PreemptibleNodes    int32
+	containersReleased  int32
+}
+
+// newYarnModel is the constructor of yarnModel struct
+// @param preemptibleNodes is the minimum number of preemptible workers of the cluster
+// @param containerMemoryMB is the memory of each container
+// @param defaultContainers is the number of containers used by jobs without a predicted number of virtual cores
+func newYarnModel(preemptibleNodes, containerMemoryMB, defaultContainers int32) yarnModel {
+	return yarnModel{
+		profile:             m.BuiltinProfiles()[m.StandardProfile],
+		containerMemoryMB:   containerMemoryMB,
+		defaultContainers:   defaultContainers,
+		MinPreemptibleNodes: preemptibleNodes,
+		PreemptibleNodes:    preemptibleNodes,
+	}
+}
+
+// allocate sizes the cluster according to its profile
+// @param profile describes the size of the cluster and the resources and costs of its workers
+// @param workers is the number of primary workers the cluster was created with
+// return the number of primary workers, at least the ones of the profile
+func (y *yarnModel) allocate(profile m.ClusterProfile, workers int32) int32 {
+	y.profile = profile
+	y.PreemptibleNodes = profile.PreemptibleNodes
+	if y.PreemptibleNodes < y.MinPreemptibleNodes {
+		y.PreemptibleNodes = y.MinPreemptibleNodes
+	}
+	if workers < profile.WorkerNodes {
+		return profile.WorkerNodes
+	}
+	return workers
+}
+
+// jobContainers returns the number of containers the job asks for
+func (y *yarnModel) jobContainers(job *m.Job) int32 {
+	if job.PredictedVCores > 0 {
+		return job.PredictedVCores
+	}
+	return y.defaultContainers
+}
+
+// cost returns what the workers cost over the given time
+// @param workers is the number of primary workers
+// @param elapsed is the time the workers have run for
+func (y *yarnModel) cost(workers int32, elapsed time.Duration) float32 {
+	return float32(elapsed.Hours() * ProfileCostPerHour(y.profile, workers, y.PreemptibleNodes))
+}
+
+// capacity returns the number of containers the workers have room for
+// @param workers is the number of primary workers
+func (y *yarnModel) capacity(workers int32) int32 {
+	return (workers + y.PreemptibleNodes) * int32(math.Min(float64(y.profile.NodeVCores),
+		float64(y.profile.NodeMemoryMB/y.containerMemoryMB)))
+}
+
+// scale changes the number of preemptible workers, new workers are available immediately
+// @param delta is the number of nodes to add or remove
+// return false if there was no worker to remove
+func (y *yarnModel) scale(delta int32) bool {
+	if delta < 0 && y.PreemptibleNodes == y.MinPreemptibleNodes {
+		return false
+	}
+	y.PreemptibleNodes = int32(math.Max(float64(y.MinPreemptibleNodes), float64(y.PreemptibleNodes+delta)))
+	return true
+}
+
+// release accounts the containers of a job which ended
+func (y *yarnModel) release(containers int32) {
+	y.containersReleased += containers
+}
+
+// heartbeat describes the YARN usage of the cluster
+// @param name is the name of the cluster
+// @param workers is the number of primary workers
+// @param running is the number of running jobs
+// @param demand is the number of containers the running jobs ask for
+// @param cost is the cost of the cluster so far
+// @param now is the time of the heartbeat
+func (y *yarnModel) heartbeat(name string, workers, running, demand int32, cost float32,
+	now time.Time) m.HeartbeatMessage {
+	capacity := y.capacity(workers)
+	allocated := int32(math.Min(float64(demand), float64(capacity)))
+	timestamp, _ := ptypes.TimestampProto(now)
+	return m.HeartbeatMessage{
+		ClusterName:                 name,
+		AppsRunning:                 running,
+		AllocatedMB:                 allocated * y.containerMemoryMB,
+		AllocatedVCores:             allocated,
+		AllocatedContainers:         allocated,
+		AggregateContainersReleased: y.containersReleased,
+		AvailableMB:                 (capacity - allocated) * y.containerMemoryMB,
+		AvailableVCores:             capacity - allocated,
+		PendingMB:                   (demand - allocated) * y.containerMemoryMB,
+		PendingVCores:               demand - allocated,
+		PendingContainers:           demand - allocated,
+		Timestamp:                   timestamp,
+		NumberOfNodes:               workers + y.PreemptibleNodes,
+		Cost:                        cost,
+	}
+}
@@ -16,76 +16,98 @@ package pool
 
 import (
 	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"obi/master/autoscaler"
 	"obi/master/autoscaler/policies"
+	"obi/master/config"
 	"obi/master/model"
 	"obi/master/platforms"
-	"os"
-	"strconv"
 )
 
-func newCluster(name, platform string, highPerformance bool, autoscalingFactor float32) (model.ClusterBaseInterface, error) {
-	var cluster model.ClusterBaseInterface
-	var err error
-
-	logrus.WithField("cluster-name", name).Info("Creating new cluster")
-
-	switch platform {
-	case "dataproc":
-		cluster, err = newDataprocCluster(name, highPerformance, autoscalingFactor)
-	default:
+// newCluster creates a cluster, adds it to the pool and allocates its resources
+// @param name is the name of the cluster
+// @param platform is the name of the registered platform on which the cluster is created
+// @param infrastructure is the name of the infrastructure the cluster belongs to
+func (p *Pool) newCluster(name, platform, infrastructure string, level int32, profile model.ClusterProfile, autoscalingFactor float32,
+		demand model.ResourceDemand, warm bool) (model.ClusterBaseInterface, error) {
+	logrus.WithFields(logrus.Fields{
+		"cluster-name":   name,
+		"profile":        profile.Name,
+		"infrastructure": infrastructure,
+	}).Info("Creating new cluster")
+
+	infra, ok := config.Get().Infrastructure(infrastructure)
+	if !ok {
+		logrus.WithField("infrastructure", infrastructure).Error("Unknown infrastructure")
+		return nil, fmt.Errorf("unknown infrastructure '%s'", infrastructure)
+	}
+	target, ok := platforms.Get(platform)
+	if !ok {
 		logrus.WithField("platform-type", platform).Error("Invalid platform type")
 		return nil, errors.New("invalid platform type")
 	}
 
-	// Check if there was an error creating the cluster structure
-	if err != nil {
-		logrus.WithField("platform-type", platform).Error("Could not create platform")
-		return nil, err
+	// Only the clusters sending heartbeats are told where to send them
+	c := config.Get()
+	hbHost, hbPort := "", 0
+	if target.Capabilities.Heartbeats {
+		hbHost, hbPort = c.HeartbeatHost, c.HeartbeatPort
 	}
+	workers, _ := target.Nodes(demand, profile)
+	cb := model.NewClusterBase(name, workers, target.Name, hbHost, hbPort)
+	cb.Infrastructure = infra.Name
+	cb.SchedulingLevel = level
+	cb.Profile = profile.Name
+	cb.Warm = warm
 
-	return cluster, err
-}
-
-func newDataprocCluster(name string, highPerformance bool, lambda float32) (*platforms.DataprocCluster, error) {
-	var minPreemptiveSize int32
-
-	nodePort, _ := strconv.Atoi(os.Getenv("HEARTBEAT_SERVICE_NODEPORT"))
-
-	cb := model.NewClusterBase(name, 2, "dataproc",
-		viper.GetString("heartbeatHost"),
-		nodePort)
+	cluster := target.New(cb, infra, profile)
 
-	if highPerformance {
-		minPreemptiveSize = 10
+	// Instantiate a new autoscaler for the new cluster
+	a, err := newAutoscaler(cluster, profile, autoscalingFactor)
+	if err != nil {
+		return nil, err
 	}
 
-	cluster := platforms.NewDataprocCluster(cb, viper.GetString("projectId"),
-		viper.GetString("zone"),
-		viper.GetString("region"), minPreemptiveSize)
-
-	// Instantiate a new autoscaler for the new cluster and start monitoring
-	policy := policies.NewWorkload(lambda)
-	a := autoscaler.New(policy, 60, cluster, false, 0)
-
 	// Add in the pool
-	GetPool().AddCluster(cluster, a)
+	p.AddCluster(cluster, a)
 	logrus.WithFields(logrus.Fields{
 		"clusterName": name,
-		"scalingFactor": lambda,
-		"downscaling": true,
+		"policy": profile.Autoscaling.Policy,
+		"scalingFactor": autoscalingFactor,
+		"downscaling": profile.Autoscaling.AllowDownscale,
 	}).Info("Autoscaler binding.")
 
-	// Allocate cluster resources
-	err := cluster.AllocateResources(highPerformance)
+	// Allocate cluster resources, the cluster is in the pool meanwhile since it may send heartbeats already
+	err = cluster.AllocateResources(profile)
 	if err != nil {
+		logrus.WithField("platform-type", platform).Error("Could not create platform")
+		p.RemoveCluster(name)
 		return nil, err
 	}
 
-	// Start the autoscaler
-	a.StartMonitoring()
+	// Start the autoscaler, the simulator steps the ones of the other platforms on its own clock
+	if target.Capabilities.RealTime {
+		a.StartMonitoring()
+	}
 
 	return cluster, nil
 }
+
+// newAutoscaler creates the autoscaler described by the profile for the given cluster
+// @param cluster is the cluster to be managed
+// @param profile is the profile the cluster is created with
+// @param lambda is the scaling factor of the level, the one of the profile is used if it is not set
+func newAutoscaler(cluster model.Scalable, profile model.ClusterProfile, lambda float32) (*autoscaler.Autoscaler,
+		error) {
+	if lambda == 0 {
+		lambda = profile.Autoscaling.Factor
+	}
+	policy, ok := policies.New(profile.Autoscaling.Policy, lambda)
+	if !ok {
+		logrus.WithField("policy", profile.Autoscaling.Policy).Error("Unknown autoscaling policy")
+		return nil, fmt.Errorf("unknown autoscaling policy '%s'", profile.Autoscaling.Policy)
+	}
+	return autoscaler.New(policy, profile.Autoscaling.Interval, cluster, profile.Autoscaling.AllowDownscale,
+		profile.Autoscaling.MaxAbsDelta), nil
+}
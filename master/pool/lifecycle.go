@@ -0,0 +1,181 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package pool
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// lifecycleCheckInterval is the interval at which the clusters are checked against the lifecycle of their profile
+const lifecycleCheckInterval = 15 * time.Second
+
+// lifecycle keeps track of the clusters being released by the pool
+type lifecycle struct {
+	// releasing contains the names of the clusters whose resources are being freed
+	releasing map[string]bool
+	releases  sync.WaitGroup
+	sync.Mutex
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		releasing: make(map[string]bool),
+	}
+}
+
+// StartLifecycleMonitoring starts the routine releasing the clusters which have been idle for too long or
+// reached their maximum lifetime
+func (p *Pool) StartLifecycleMonitoring() {
+	logrus.Info("Starting cluster lifecycle routine.")
+	go lifecycleRoutine(p)
+}
+
+// goroutine which periodically enforces the lifecycle of the clusters. It will be stop when the `quit`
+// channel is closed
+// @param pool contains the clusters to check
+func lifecycleRoutine(pool *Pool) {
+	ticker := time.NewTicker(lifecycleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.quit:
+			logrus.Info("Closing cluster lifecycle routine.")
+			return
+		case <-ticker.C:
+		}
+		pool.EnforceLifecycle()
+	}
+}
+
+// EnforceLifecycle releases the running clusters which reached the maximum lifetime of their profile,
+// failing the jobs they are still running, and the ones which have been without jobs for longer than the
+// idle timeout of their profile. Clusters whose release failed are released again
+func (p *Pool) EnforceLifecycle() {
+	now := utils.Now()
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		profile, ok := config.Get().ClusterProfile(cluster.GetProfile())
+		if !ok {
+			return true
+		}
+
+		switch cluster.GetStatus() {
+		case model.ClusterStatusRunning:
+			maxLifetime := time.Duration(profile.Lifecycle.MaxLifetime) * time.Second
+			idleTimeout := time.Duration(profile.Lifecycle.IdleTimeout) * time.Second
+			if maxLifetime > 0 && now.Sub(cluster.GetCreationTimestamp()) >= maxLifetime {
+				p.expireCluster(cluster, maxLifetime)
+			} else if idleSince := cluster.GetIdleSince(); !idleSince.IsZero() && now.Sub(idleSince) >= idleTimeout {
+				p.releaseIdleCluster(cluster)
+			}
+		case model.ClusterStatusDeleting:
+			p.releaseCluster(cluster)
+		}
+		return true
+	})
+}
+
+// releaseIdleCluster releases a cluster, unless new jobs were assigned to it in the meanwhile
+func (p *Pool) releaseIdleCluster(cluster model.ClusterBaseInterface) {
+	cluster.Lock()
+	if cluster.GetStatus() != model.ClusterStatusRunning || cluster.GetAllocatedJobSlots() > 0 {
+		cluster.Unlock()
+		return
+	}
+	cluster.SetStatus(model.ClusterStatusDeleting)
+	cluster.Unlock()
+	persistent.Write(cluster)
+
+	logrus.WithFields(logrus.Fields{
+		"clusterName": cluster.GetName(),
+		"idleSince":   cluster.GetIdleSince(),
+	}).Info("Releasing idle cluster")
+	p.releaseCluster(cluster)
+}
+
+// expireCluster releases a cluster which reached its maximum lifetime, cancelling its jobs and marking them
+// as failed
+// @param maxLifetime is the maximum lifetime of the profile of the cluster
+func (p *Pool) expireCluster(cluster model.ClusterBaseInterface, maxLifetime time.Duration) {
+	cluster.Lock()
+	if cluster.GetStatus() != model.ClusterStatusRunning {
+		cluster.Unlock()
+		return
+	}
+	cluster.SetStatus(model.ClusterStatusDeleting)
+	cluster.Unlock()
+	persistent.Write(cluster)
+
+	logrus.WithFields(logrus.Fields{
+		"clusterName": cluster.GetName(),
+		"maxLifetime": maxLifetime.String(),
+		"jobs":        cluster.GetAllocatedJobSlots(),
+	}).Warning("Cluster reached its maximum lifetime")
+
+	cluster.StopMonitoringJobs()
+	reason := fmt.Sprintf("cluster %s reached its maximum lifetime of %s", cluster.GetName(), maxLifetime)
+	for _, job := range cluster.GetJobs() {
+		if err := cluster.CancelJob(job); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"jobID": job.ID,
+				"error": err,
+			}).Warning("Could not cancel job of expired cluster")
+		}
+		failJob(job, reason)
+	}
+
+	p.releaseCluster(cluster)
+}
+
+// releaseCluster frees the resources of a cluster marked as deleting, in background. The cluster leaves the
+// pool once it stops sending heartbeats
+func (p *Pool) releaseCluster(cluster model.ClusterBaseInterface) {
+	name := cluster.GetName()
+	p.lifecycle.Lock()
+	defer p.lifecycle.Unlock()
+	if p.lifecycle.releasing[name] {
+		return
+	}
+	p.lifecycle.releasing[name] = true
+
+	cluster.StopMonitoringJobs()
+	p.lifecycle.releases.Add(1)
+	go func() {
+		defer p.lifecycle.releases.Done()
+		err := cluster.FreeResources()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"clusterName": name,
+				"error":       err,
+			}).Error("Could not free the resources of the cluster, retrying later")
+		}
+		p.lifecycle.Lock()
+		delete(p.lifecycle.releasing, name)
+		p.lifecycle.Unlock()
+	}()
+}
+
+// WaitReleases blocks until the clusters released so far have been freed
+func (p *Pool) WaitReleases() {
+	p.lifecycle.releases.Wait()
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package pool
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"obi/master/events"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+)
+
+// SetJobRequeuer sets the function scheduling again the jobs of the lost clusters which can be retried
+// @param requeue is usually the ScheduleJob method of the scheduler
+func (p *Pool) SetJobRequeuer(requeue func(job *model.Job)) {
+	p.requeue = requeue
+}
+
+// clusterLost handles a cluster which is not available anymore: it leaves the pool, its job monitor is
+// stopped and each of its jobs either gets the final state reported by the platform or, if it did not end,
+// is scheduled again or marked as failed according to its retry policy
+// @param cluster is the lost cluster
+// @param reason describes how the loss was detected
+func (p *Pool) clusterLost(cluster model.ClusterBaseInterface, reason string) {
+	// The liveliness check and the reconciler may both detect the loss, only the first one handles it
+	cluster.Lock()
+	if cluster.GetStatus() == model.ClusterStatusClosed {
+		cluster.Unlock()
+		return
+	}
+	cluster.SetStatus(model.ClusterStatusClosed)
+	cluster.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"clusterName": cluster.GetName(),
+		"reason":      reason,
+	}).Warning("Cluster lost")
+
+	p.RemoveCluster(cluster.GetName())
+	cluster.StopMonitoringJobs()
+	persistent.Write(cluster)
+
+	for _, job := range cluster.GetJobs() {
+		p.recoverJob(cluster, job)
+	}
+}
+
+// recoverJob settles a job of a lost cluster
+func (p *Pool) recoverJob(cluster model.ClusterBaseInterface, job *model.Job) {
+	status, err := cluster.GetJobStatus(job)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"jobID": job.ID,
+			"error": err,
+		}).Warning("Could not get the final status of the job, considering it lost")
+		status = model.JobStatusRunning
+	}
+
+	// The cluster may still be alive, the job must not keep running there once it is scheduled again or failed
+	if status == model.JobStatusRunning {
+		if err := cluster.CancelJob(job); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"jobID": job.ID,
+				"error": err,
+			}).Warning("Could not cancel job of lost cluster")
+		}
+	}
+
+	if status == model.JobStatusRunning && job.CanRetry() && p.requeue != nil {
+		job.Retries++
+		job.Status = model.JobStatusPending
+		job.Cluster = nil
+		job.PlatformDependentID = ""
+		job.DriverOutputPath = ""
+		persistent.Write(job)
+		logrus.WithFields(logrus.Fields{
+			"jobID":   job.ID,
+			"retries": job.Retries,
+		}).Info("Scheduling again job of lost cluster")
+		p.requeue(job)
+		return
+	}
+
+	if status == model.JobStatusRunning || status == model.JobStatusPending {
+		status = model.JobStatusFailed
+		job.FailureReason = fmt.Sprintf("cluster %s was lost", cluster.GetName())
+	}
+	job.Status = status
+	job.CheckDeadline(utils.Now())
+	persistent.Write(job)
+	if outcome, ok := job.FailureOutcome(utils.Now()); ok {
+		persistent.Write(outcome)
+	}
+	events.PublishJob(events.JobFinished, job)
+	logrus.WithFields(logrus.Fields{
+		"jobID":  job.ID,
+		"status": model.JobStatusNames[job.Status],
+	}).Info("Settled job of lost cluster")
+}
@@ -32,25 +32,53 @@ type Pool struct {
 	quit chan struct{}
 	killTimeout int16
 	sleepInterval int
+	warm *warmPool
+	queue *deploymentQueue
+	reconciler *reconciler
+	requeue func(job *model.Job)
+	lifecycle *lifecycle
 }
 
-// singleton instance
-var poolInstance *Pool
+// Option customizes a Pool created with New
+type Option func(*Pool)
 
-// GetPool is for retrieving the singleton Pool struct
+// WithKillTimeout sets after how many seconds without heartbeats a cluster is considered lost
+// @param seconds is the timeout, 60 by default
+func WithKillTimeout(seconds int16) Option {
+	return func(p *Pool) {
+		p.killTimeout = seconds
+	}
+}
+
+// WithCheckInterval sets the number of seconds between two liveliness checks
+// @param seconds is the interval, 30 by default
+func WithCheckInterval(seconds int) Option {
+	return func(p *Pool) {
+		p.sleepInterval = seconds
+	}
+}
+
+// New is the constructor of the Pool struct. Each pool is independent from the others
+// @param options customize the pool
 // return the pointer to the instance
-func GetPool() *Pool {
-	if poolInstance == nil {
-		poolInstance = &Pool{
-			sync.Map{},
-			sync.Map{},
-			make(chan struct{}),
-			60,
-			30,
-		}
+func New(options ...Option) *Pool {
+	p := &Pool{
+		sync.Map{},
+		sync.Map{},
+		make(chan struct{}),
+		60,
+		30,
+		nil,
+		newDeploymentQueue(),
+		nil,
+		nil,
+		newLifecycle(),
+	}
+	for _, option := range options {
+		option(p)
 	}
 
-	return poolInstance
+	return p
 }
 
 // AddCluster is for adding a new cluster inside the pool
@@ -74,26 +102,30 @@ func (p *Pool) RemoveCluster(clusterName string) {
 		obj.(*autoscaler.Autoscaler).StopMonitoring()
 	}
 	p.autoscalers.Delete(clusterName)
+
+	// The freed resources may allow some queued deployment
+	p.queue.signal()
 }
 
-// LivelinessCheck is the the procedure to delete dead clusters from the pool
+// LivelinessCheck is the the procedure to delete dead clusters from the pool. Their resources are left to
+// the reconciler, as well as the clusters which never sent a heartbeat
 func (p *Pool) LivelinessCheck(timeout int16) {
 	p.clusters.Range(func(key interface{}, value interface{}) bool {
 		cluster := value.(model.ClusterBaseInterface)
-		var lastHeartbeat model.HeartbeatMessage
-		for hb := range cluster.GetMetricsWindow().Iter() {
-			if hb.Value != nil {
-				lastHeartbeat = hb.Value.(model.HeartbeatMessage)
-			}
-		}
+		lastHeartbeat, _ := model.LastMetrics(cluster.GetMetricsWindow())
 
 		if lastHeartbeat.ClusterName != "" {
 			lastTimestamp, _ := ptypes.Timestamp(lastHeartbeat.Timestamp)
 			lastHeartbeatInterval := int16(time.Now().Sub(lastTimestamp).Seconds())
 			if lastHeartbeatInterval > timeout {
 				clusterName := cluster.GetName()
-				logrus.WithField("Name", clusterName).Info("Deleting cluster.")
-				p.RemoveCluster(clusterName)
+				status := cluster.GetStatus()
+				if status == model.ClusterStatusClosed || status == model.ClusterStatusDeleting {
+					logrus.WithField("Name", clusterName).Info("Deleting cluster.")
+					p.RemoveCluster(clusterName)
+				} else {
+					p.clusterLost(cluster, "heartbeat timeout")
+				}
 			}
 		}
 		return true
@@ -107,10 +139,37 @@ func (p *Pool) GetCluster(clusterName string) (interface{}, bool) {
 	return p.clusters.Load(clusterName)
 }
 
+// GetAutoscaler is for getting the autoscaler of a specific cluster inside the pool
+// @param clusterName is the name of the cluster
+// return the autoscaler and a bool to check if it is present
+func (p *Pool) GetAutoscaler(clusterName string) (*autoscaler.Autoscaler, bool) {
+	obj, ok := p.autoscalers.Load(clusterName)
+	if !ok {
+		return nil, false
+	}
+	return obj.(*autoscaler.Autoscaler), true
+}
+
+// FindCluster is for getting any cluster inside the pool satisfying the given condition
+// @param match is the condition the cluster has to satisfy
+// return the first matching cluster, nil if none is found
+func (p *Pool) FindCluster(match func(model.ClusterBaseInterface) bool) model.ClusterBaseInterface {
+	var found model.ClusterBaseInterface
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		if match(cluster) {
+			found = cluster
+			return false
+		}
+		return true
+	})
+	return found
+}
+
 // StartLivelinessMonitoring starts the execution of the liveliness monitor routine
 func (p *Pool) StartLivelinessMonitoring() {
 	logrus.Info("Starting cluster tracker routine.")
-	go livelinessMonitorRoutine(poolInstance)
+	go livelinessMonitorRoutine(p)
 }
 
 // StopLivelinessMonitoring stops the execution of the liveliness monitor routine
@@ -0,0 +1,372 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package pool
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/platforms"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// ErrDeploymentQueued is returned when the cluster of a deployment cannot be created yet because of the limits
+var ErrDeploymentQueued = errors.New("deployment queued because of the cluster limits")
+
+// queueCheckInterval is the interval at which the queued deployments are checked against the limits,
+// besides every time a cluster leaves the pool
+const queueCheckInterval = 30 * time.Second
+
+// usage is the amount of resources taken by some clusters
+type usage struct {
+	clusters int32
+	nodes    int32
+	spend    float64
+}
+
+func (u *usage) add(other usage) {
+	u.clusters += other.clusters
+	u.nodes += other.nodes
+	u.spend += other.spend
+}
+
+// exceeds checks whether adding the given usage to the current one would go beyond the limits
+func (u *usage) exceeds(l config.Limits, more usage) bool {
+	return (l.MaxClusters > 0 && u.clusters+more.clusters > l.MaxClusters) ||
+		(l.MaxNodes > 0 && u.nodes+more.nodes > l.MaxNodes) ||
+		(l.MaxHourlySpend > 0 && u.spend+more.spend > l.MaxHourlySpend)
+}
+
+// reservation is the usage of a deployment whose cluster is being created
+type reservation struct {
+	usage
+	// cluster is the name of the cluster, empty until it is chosen. Once the cluster is in the pool its own
+	// usage is counted instead
+	cluster string
+}
+
+// deploymentQueue holds the deployments waiting for the limits, in the order they were queued,
+// and the usage reserved for the clusters being created
+type deploymentQueue struct {
+	entries []*model.QueuedDeployment
+	// reserved is the usage of the deployments whose cluster is being created and may not be in the pool yet
+	reserved map[*model.QueuedDeployment]reservation
+	// globalWait tells whether the oldest deployments are waiting for the global limits
+	globalWait  bool
+	wake        chan struct{}
+	deployments sync.WaitGroup
+	sync.Mutex
+}
+
+func newDeploymentQueue() *deploymentQueue {
+	return &deploymentQueue{
+		reserved: make(map[*model.QueuedDeployment]reservation),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// signal wakes up the routine releasing the queued deployments, without waiting for it
+func (q *deploymentQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// mustWait checks whether older deployments which the given one must not overtake are waiting
+func (q *deploymentQueue) mustWait(d *model.QueuedDeployment) bool {
+	if q.globalWait {
+		return true
+	}
+	for _, queued := range q.entries {
+		if queued.Infrastructure == d.Infrastructure && queued.Level == d.Level {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterUsage returns the usage of a cluster according to its workers and to what they cost on its platform
+func clusterUsage(target platforms.Platform, profile model.ClusterProfile, workers, preemptible int32) usage {
+	costPerHour := target.CostPerHour
+	if costPerHour == nil {
+		costPerHour = platforms.ProfileCostPerHour
+	}
+	return usage{
+		clusters: 1,
+		nodes:    workers + preemptible,
+		spend:    costPerHour(profile, workers, preemptible),
+	}
+}
+
+// deploymentUsage estimates the usage of the cluster which would be created for the deployment, sized and priced
+// by the platform of its infrastructure
+func deploymentUsage(d *model.QueuedDeployment, profile model.ClusterProfile) usage {
+	infra, ok := config.Get().Infrastructure(d.Infrastructure)
+	if !ok {
+		infra, _ = config.Get().Infrastructure("")
+	}
+	target, ok := platforms.Get(infra.Platform)
+	if !ok {
+		logrus.WithField("platform", infra.Platform).Warning("Unknown platform for queued deployment")
+		return clusterUsage(target, profile, profile.WorkerNodes, profile.PreemptibleNodes)
+	}
+	workers, preemptible := target.Nodes(d.Demand, profile)
+	return clusterUsage(target, profile, workers, preemptible)
+}
+
+// deploymentProfile returns the cluster profile of the deployment, the standard one if it is not configured anymore
+func deploymentProfile(d *model.QueuedDeployment) model.ClusterProfile {
+	profile, ok := config.Get().ClusterProfile(d.Profile)
+	if !ok {
+		logrus.WithField("profile", d.Profile).Warning("Unknown cluster profile for queued deployment")
+		profile, _ = config.Get().ClusterProfile(model.StandardProfile)
+	}
+	return profile
+}
+
+// levelKey identifies a scheduling level of an infrastructure
+type levelKey struct {
+	infrastructure string
+	level          int32
+}
+
+// levelLimits returns the limits of the given scheduling level of an infrastructure, none for the
+// "one job one cluster" levels
+func levelLimits(c *config.Config, infrastructure string, level int32) config.Limits {
+	infra, ok := c.Infrastructure(infrastructure)
+	if !ok || level < 0 || int(level) >= len(infra.SchedulingLevels) {
+		return config.Limits{}
+	}
+	return infra.SchedulingLevels[level].Limits
+}
+
+// currentUsage returns the usage of the clusters in the pool and of the ones being created, both overall and
+// for the given scheduling level of an infrastructure. It must be called holding the lock of the queue
+func (p *Pool) currentUsage(infrastructure string, level int32) (usage, usage) {
+	var global, levelUsage usage
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		if cluster.GetStatus() == model.ClusterStatusClosed {
+			return true
+		}
+		profile, _ := config.Get().ClusterProfile(cluster.GetProfile())
+		target, _ := platforms.Get(cluster.GetPlatform())
+		u := clusterUsage(target, profile, cluster.GetWorkerNodes(), cluster.GetPreemptibleNodes())
+		global.add(u)
+		if cluster.GetInfrastructure() == infrastructure && cluster.GetSchedulingLevel() == level {
+			levelUsage.add(u)
+		}
+		return true
+	})
+	for d, r := range p.queue.reserved {
+		if _, pooled := p.clusters.Load(r.cluster); r.cluster != "" && pooled {
+			continue
+		}
+		global.add(r.usage)
+		if d.Infrastructure == infrastructure && d.Level == level {
+			levelUsage.add(r.usage)
+		}
+	}
+	return global, levelUsage
+}
+
+// fits checks whether a new cluster for the deployment would respect the global and the level limits.
+// It must be called holding the lock of the queue
+// return whether the cluster fits and, if it does not, whether the global limits are the reason
+func (p *Pool) fits(d *model.QueuedDeployment, profile model.ClusterProfile) (bool, bool) {
+	c := config.Get()
+	global, levelUsage := p.currentUsage(d.Infrastructure, d.Level)
+	more := deploymentUsage(d, profile)
+	if global.exceeds(c.Limits, more) {
+		return false, true
+	}
+	if levelUsage.exceeds(levelLimits(c, d.Infrastructure, d.Level), more) {
+		return false, false
+	}
+	return true, false
+}
+
+// admitDeployment reserves the resources of a new cluster for the deployment, or appends the deployment to the
+// queue if it would exceed the limits or if older deployments it must not overtake are waiting
+// return true if the cluster can be created right away, in which case endDeployment must be called once it is
+func (p *Pool) admitDeployment(d *model.QueuedDeployment, profile model.ClusterProfile) bool {
+	p.queue.Lock()
+	defer p.queue.Unlock()
+
+	if !p.queue.mustWait(d) {
+		if ok, _ := p.fits(d, profile); ok {
+			p.queue.reserved[d] = reservation{usage: deploymentUsage(d, profile)}
+			return true
+		}
+	}
+
+	p.queue.entries = append(p.queue.entries, d)
+	persistent.Write(d)
+	logrus.WithFields(logrus.Fields{
+		"infrastructure": d.Infrastructure,
+		"level":          d.Level,
+		"profile":        d.Profile,
+		"jobs":           len(d.Jobs),
+		"queued":         len(p.queue.entries),
+	}).Info("Deployment queued because of the cluster limits")
+	return false
+}
+
+// reserveCluster records the name of the cluster created for the deployment, so that the reserved usage is not
+// counted twice once the cluster is in the pool
+func (p *Pool) reserveCluster(d *model.QueuedDeployment, clusterName string) {
+	p.queue.Lock()
+	defer p.queue.Unlock()
+	if r, ok := p.queue.reserved[d]; ok {
+		r.cluster = clusterName
+		p.queue.reserved[d] = r
+	}
+}
+
+// endDeployment releases the resources reserved for the deployment, once its cluster is in the pool or
+// could not be created
+func (p *Pool) endDeployment(d *model.QueuedDeployment) {
+	p.queue.Lock()
+	delete(p.queue.reserved, d)
+	p.queue.Unlock()
+	p.queue.signal()
+}
+
+// withinLimits checks whether a new cluster with the given usage would respect the global limits,
+// without overtaking any queued deployment
+func (p *Pool) withinLimits(u usage) bool {
+	p.queue.Lock()
+	defer p.queue.Unlock()
+	if len(p.queue.entries) > 0 {
+		return false
+	}
+	global, _ := p.currentUsage("", -1)
+	return !global.exceeds(config.Get().Limits, u)
+}
+
+// ReleaseQueued creates the clusters of the queued deployments which the limits allow by now, in the order they
+// were queued. A deployment blocked by the limits of its level only holds back the later ones of the same level
+// of the same infrastructure
+func (p *Pool) ReleaseQueued() {
+	p.queue.Lock()
+	defer p.queue.Unlock()
+
+	p.queue.globalWait = false
+	blockedLevels := make(map[levelKey]bool)
+	var waiting []*model.QueuedDeployment
+	for _, d := range p.queue.entries {
+		if p.queue.globalWait || blockedLevels[levelKey{d.Infrastructure, d.Level}] {
+			waiting = append(waiting, d)
+			continue
+		}
+		profile := deploymentProfile(d)
+		ok, global := p.fits(d, profile)
+		if !ok {
+			if global {
+				p.queue.globalWait = true
+			} else {
+				blockedLevels[levelKey{d.Infrastructure, d.Level}] = true
+			}
+			waiting = append(waiting, d)
+			continue
+		}
+
+		p.queue.reserved[d] = reservation{usage: deploymentUsage(d, profile)}
+		persistent.DeleteQueuedDeployment(d.ID)
+		logrus.WithFields(logrus.Fields{
+			"infrastructure": d.Infrastructure,
+			"level":          d.Level,
+			"profile":        d.Profile,
+			"jobs":           len(d.Jobs),
+			"waited":         utils.Now().Sub(d.Timestamp).String(),
+		}).Info("Releasing queued deployment")
+
+		p.queue.deployments.Add(1)
+		go func(d *model.QueuedDeployment, profile model.ClusterProfile) {
+			defer p.queue.deployments.Done()
+			p.deployOnNewCluster(d, profile)
+			p.endDeployment(d)
+		}(d, profile)
+	}
+	p.queue.entries = waiting
+}
+
+// WaitDeployments blocks until the clusters of the deployments released so far have been created
+func (p *Pool) WaitDeployments() {
+	p.queue.deployments.Wait()
+}
+
+// QueuedDeployments returns the deployments waiting for the limits, in the order they were queued
+func (p *Pool) QueuedDeployments() []*model.QueuedDeployment {
+	p.queue.Lock()
+	defer p.queue.Unlock()
+	return append([]*model.QueuedDeployment(nil), p.queue.entries...)
+}
+
+// RestoreDeploymentQueue loads the deployments left in the persistent queue by a previous run of the master
+// return the IDs of the jobs of the restored deployments
+func (p *Pool) RestoreDeploymentQueue() map[int]bool {
+	deployments, err := persistent.GetQueuedDeployments()
+	if err != nil {
+		logrus.WithField("error", err).Error("Unable to load queued deployments from database")
+		return nil
+	}
+
+	jobIDs := make(map[int]bool)
+	p.queue.Lock()
+	for _, d := range deployments {
+		p.queue.entries = append(p.queue.entries, d)
+		for _, job := range d.Jobs {
+			jobIDs[job.ID] = true
+		}
+	}
+	p.queue.Unlock()
+
+	if len(deployments) > 0 {
+		logrus.WithField("deployments", len(deployments)).Info("Restored queued deployments")
+		p.queue.signal()
+	}
+	return jobIDs
+}
+
+// StartDeploymentQueue starts the routine releasing the queued deployments as clusters are freed
+func (p *Pool) StartDeploymentQueue() {
+	logrus.Info("Starting deployment queue routine.")
+	go deploymentQueueRoutine(p)
+}
+
+// goroutine which releases the queued deployments every time a cluster leaves the pool and periodically,
+// since the autoscalers change the usage of the clusters. It will be stop when the `quit` channel is closed
+// @param pool contains the queue
+func deploymentQueueRoutine(pool *Pool) {
+	ticker := time.NewTicker(queueCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.quit:
+			logrus.Info("Closing deployment queue routine.")
+			return
+		case <-pool.queue.wake:
+		case <-ticker.C:
+		}
+		pool.ReleaseQueued()
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package pool
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/platforms"
+	"sync"
+	"time"
+)
+
+// reconciler aligns the pool and the database with the clusters which actually exist on the platforms
+type reconciler struct {
+	config.Reconciler
+	// handled maps the clusters which were deleted or alerted to the action taken, so that it is not repeated
+	// while they are still listed by their platform
+	handled map[string]string
+	sync.Mutex
+}
+
+// StartReconciler enables the reconciliation of the clusters and, if an interval is configured, starts the
+// routine reconciling them periodically
+// @param c is the configuration of the reconciler
+func (p *Pool) StartReconciler(c config.Reconciler) {
+	p.reconciler = &reconciler{
+		Reconciler: c,
+		handled:    make(map[string]string),
+	}
+	if c.Interval <= 0 {
+		return
+	}
+
+	logrus.Info("Starting cluster reconciler routine.")
+	go reconcilerRoutine(p)
+}
+
+// goroutine which periodically reconciles the clusters. It will be stop when the `quit` channel is closed
+// @param pool contains the clusters to reconcile
+func reconcilerRoutine(pool *Pool) {
+	ticker := time.NewTicker(time.Duration(pool.reconciler.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.quit:
+			logrus.Info("Closing cluster reconciler routine.")
+			return
+		case <-ticker.C:
+		}
+		pool.Reconcile()
+	}
+}
+
+// Reconcile compares the clusters listed by the platforms of the infrastructures with the ones in the pool and
+// in the database. Clusters missing from the pool are adopted, deleted or alerted according to the policies,
+// while clusters which do not exist anymore are removed from the pool and closed in the database
+func (p *Pool) Reconcile() {
+	r := p.reconciler
+	r.Lock()
+	defer r.Unlock()
+
+	records, err := persistent.GetActiveClusters()
+	if err != nil {
+		logrus.WithField("error", err).Error("Unable to load clusters from database")
+		return
+	}
+	gracePeriod := time.Duration(r.GracePeriod) * time.Second
+
+	c := config.Get()
+	listed := make(map[string]bool)
+	for _, name := range c.InfrastructureNames() {
+		infra := c.Infrastructures[name]
+		if !isReconciled(infra.Platform) {
+			continue
+		}
+		names, err := platforms.ListClusters(infra)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"infrastructure": name,
+				"platform":       infra.Platform,
+				"error":          err,
+			}).Error("Unable to list clusters, skipping reconciliation")
+			continue
+		}
+
+		existing := make(map[string]bool)
+		for _, clusterName := range names {
+			existing[clusterName] = true
+			listed[clusterName] = true
+			if _, ok := p.clusters.Load(clusterName); !ok {
+				p.reconcileMissing(infra, clusterName, findRecord(records, clusterName))
+			}
+		}
+
+		// Clusters of the pool which disappeared from their platform
+		p.clusters.Range(func(key interface{}, value interface{}) bool {
+			cluster := value.(model.ClusterBaseInterface)
+			status := cluster.GetStatus()
+			if infrastructureName(cluster.GetInfrastructure()) != name || existing[cluster.GetName()] ||
+				status == model.ClusterStatusDeleting || status == model.ClusterStatusClosed ||
+				time.Now().Sub(cluster.GetCreationTimestamp()) < gracePeriod {
+				return true
+			}
+			p.removeLostCluster(cluster)
+			return true
+		})
+
+		// Clusters of the database which exist neither on their platform nor in the pool
+		for _, record := range records {
+			if infrastructureName(record.Infrastructure) != name || existing[record.Name] ||
+				time.Now().Sub(record.CreationTimestamp) < gracePeriod {
+				continue
+			}
+			if _, ok := p.clusters.Load(record.Name); ok {
+				continue
+			}
+			if err := persistent.CloseCluster(record.Name, record.CreationTimestamp); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"clusterName": record.Name,
+					"error":       err,
+				}).Error("Unable to close cluster in database")
+				continue
+			}
+			recordAction(record.Name, record.Platform, model.ReconcileClose, fmt.Sprintf(
+				"recorded as %s in the database but missing from the platform",
+				model.ClusterStatusNames[record.Status]))
+		}
+	}
+
+	// Forget the clusters which are gone, they will be handled again if they ever come back
+	for name := range r.handled {
+		if !listed[name] {
+			delete(r.handled, name)
+		}
+	}
+}
+
+// ReconcileCluster applies the reconciliation policies to a single cluster existing on its platform but
+// missing from the pool, e.g. when it sends a heartbeat. The cluster is looked for in the infrastructure
+// it is recorded with in the database, in the default one if it is not recorded
+// @param clusterName is the name of the cluster
+func (p *Pool) ReconcileCluster(clusterName string) {
+	r := p.reconciler
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	// The cluster may have been reconciled in the meanwhile
+	if _, ok := p.clusters.Load(clusterName); ok {
+		return
+	}
+	records, err := persistent.GetActiveClusters()
+	if err != nil {
+		logrus.WithField("error", err).Error("Unable to load clusters from database")
+		return
+	}
+	record := findRecord(records, clusterName)
+	var infrastructure string
+	if record != nil {
+		infrastructure = record.Infrastructure
+	}
+	infra, ok := config.Get().Infrastructure(infrastructure)
+	if !ok || !isReconciled(infra.Platform) {
+		logrus.WithFields(logrus.Fields{
+			"clusterName":    clusterName,
+			"infrastructure": infrastructure,
+		}).Warning("Cluster not managed by the pool and of an unknown infrastructure")
+		return
+	}
+	p.reconcileMissing(infra, clusterName, record)
+}
+
+// reconcileMissing applies the policy for a cluster which exists on its platform but not in the pool.
+// It must be called holding the lock of the reconciler
+// @param record is the cluster in the database, nil if it is not recorded there
+func (p *Pool) reconcileMissing(infra config.Infrastructure, clusterName string,
+	record *persistent.ClusterRecord) {
+	r := p.reconciler
+	if _, ok := r.handled[clusterName]; ok {
+		return
+	}
+
+	action, reason := r.Unknown, "not recorded in the database"
+	if record != nil {
+		action = r.Orphans
+		reason = fmt.Sprintf("recorded as %s in the database but missing from the pool",
+			model.ClusterStatusNames[record.Status])
+		if record.Status == model.ClusterStatusDeleting {
+			// The master stopped while deleting the cluster
+			action = model.ReconcileDelete
+		}
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"clusterName":    clusterName,
+		"infrastructure": infra.Name,
+		"platform":       infra.Platform,
+		"reason":         reason,
+	})
+	switch action {
+	case model.ReconcileAdopt:
+		if err := p.AdoptCluster(infra, clusterName); err != nil {
+			logger.WithField("error", err).Error("Unable to adopt cluster")
+			return
+		}
+		logger.Info("Adopted cluster")
+	case model.ReconcileDelete:
+		cluster, err := platforms.NewExistingCluster(infra, clusterName)
+		if err != nil {
+			logger.WithField("error", err).Error("Unable to delete cluster")
+			return
+		}
+		logger.Info("Deleting cluster")
+		go cluster.FreeResources()
+		r.handled[clusterName] = action
+	case model.ReconcileAlert:
+		logger.Warning("Cluster not managed by the pool")
+		r.handled[clusterName] = action
+	}
+	recordAction(clusterName, infra.Platform, action, reason)
+}
+
+// removeLostCluster handles a cluster of the pool which does not exist anymore on its platform
+func (p *Pool) removeLostCluster(cluster model.ClusterBaseInterface) {
+	p.clusterLost(cluster, "missing from the platform")
+	recordAction(cluster.GetName(), cluster.GetPlatform(), model.ReconcileRemove,
+		"in the pool but missing from the platform")
+}
+
+// AdoptCluster adds to the pool a cluster already existing on its platform, monitoring it with the
+// autoscaler of its profile
+// @param infra is the infrastructure the cluster belongs to
+// @param clusterName is the name of the cluster
+func (p *Pool) AdoptCluster(infra config.Infrastructure, clusterName string) error {
+	cluster, err := platforms.NewExistingCluster(infra, clusterName)
+	if err != nil {
+		return err
+	}
+
+	// The platforms which do not keep the profile of their clusters adopt them with the standard one
+	profile, ok := config.Get().ClusterProfile(cluster.GetProfile())
+	if !ok {
+		logrus.WithField("profile", cluster.GetProfile()).Warning("Unknown cluster profile for adopted cluster")
+		profile, _ = config.Get().ClusterProfile(model.StandardProfile)
+	}
+	a, err := newAutoscaler(cluster.(model.Scalable), profile, 0)
+	if err != nil {
+		return err
+	}
+	p.AddCluster(cluster, a)
+	a.StartMonitoring()
+
+	logrus.WithField("clusterName", clusterName).Info("Added cluster in the pool")
+	return nil
+}
+
+// isReconciled checks whether the clusters of the given platform can be listed and reconciled
+func isReconciled(platform string) bool {
+	p, ok := platforms.Get(platform)
+	return ok && p.Capabilities.Listable
+}
+
+// infrastructureName maps the clusters recorded before the introduction of the infrastructures to the default one
+func infrastructureName(name string) string {
+	if name == "" {
+		return config.Get().DefaultInfrastructure
+	}
+	return name
+}
+
+func findRecord(records []*persistent.ClusterRecord, clusterName string) *persistent.ClusterRecord {
+	for _, record := range records {
+		if record.Name == clusterName {
+			return record
+		}
+	}
+	return nil
+}
+
+func recordAction(clusterName string, platform string, action string, reason string) {
+	persistent.Write(&model.ReconciliationAction{
+		ClusterName: clusterName,
+		Platform:    platform,
+		Action:      action,
+		Reason:      reason,
+		Timestamp:   time.Now(),
+	})
+}
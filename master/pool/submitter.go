@@ -17,6 +17,8 @@ package pool
 import (
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/events"
 			"obi/master/model"
 	"obi/master/persistent"
 		"obi/master/utils"
@@ -26,45 +28,138 @@ import (
 // It exposes a method that receives as parameter the list of jobs to deploy in the same cluster.
 // It creates a new cluster that, after being added in the pool for further actions, will host the new jobs.
 type Submitter struct {
-
+	// Platform is the name of the platform on which the new clusters are created
+	Platform string
+	// Infrastructure is the name of the infrastructure the new clusters belong to
+	Infrastructure string
+	pool           *Pool
 }
 
 // NewSubmitter is the constructor of Pooling struct
-// @param pool is the list of clusters to update with new ones
-func NewSubmitter() *Submitter {
+// @param p is the pool in which the new clusters are added
+// @param infrastructure is the infrastructure in which the clusters are created
+func NewSubmitter(p *Pool, infrastructure config.Infrastructure) *Submitter {
 
 	// Create Pooling object
-	logrus.Info("Creating cluster scheduling")
+	logrus.WithField("infrastructure", infrastructure.Name).Info("Creating cluster scheduling")
 
-	pooling := &Submitter{}
+	pooling := &Submitter{infrastructure.Platform, infrastructure.Name, p}
 
 	return pooling
 }
 
 // DeployJobs is for deploying the list of jobs into a single cluster
 // @param jobs is the list of jobs to deploy
-func (s *Submitter) DeployJobs(jobs []*model.Job, highPerformance bool, autoscalingFactor float32) {
+// @param level is the scheduling level the jobs come from
+// @param profile is the profile of the cluster to create
+// @param autoscalingFactor is the scaling factor of the cluster autoscaler, the one of the profile if 0
+// @param demand is the aggregate predicted demand of the jobs, used to choose the initial cluster size
+// return the cluster hosting the jobs, ErrDeploymentQueued if the limits do not allow a new cluster yet,
+// in which case the jobs are deployed once they do
+func (s *Submitter) DeployJobs(jobs []*model.Job, level int32, profile model.ClusterProfile,
+		autoscalingFactor float32, demand model.ResourceDemand) (model.ClusterBaseInterface, error) {
+
+	// Claim a cluster from the warm pool, if any is available
+	if cluster := s.pool.ClaimWarmCluster(s.Infrastructure, profile, level, autoscalingFactor); cluster != nil {
+		submitJobs(cluster, jobs)
+		return cluster, nil
+	}
+
+	// Create new cluster, unless it would exceed the limits
+	deployment := &model.QueuedDeployment{
+		Level:             level,
+		Platform:          s.Platform,
+		Infrastructure:    s.Infrastructure,
+		Profile:           profile.Name,
+		AutoscalingFactor: autoscalingFactor,
+		Demand:            demand,
+		Jobs:              jobs,
+		Timestamp:         utils.Now(),
+	}
+	if !s.pool.admitDeployment(deployment, profile) {
+		return nil, ErrDeploymentQueued
+	}
+	defer s.pool.endDeployment(deployment)
+
+	return s.pool.deployOnNewCluster(deployment, profile)
+}
 
-	// Create new cluster
+// deployOnNewCluster creates a new cluster for the deployment and submits its jobs to it
+// @param d is the deployment
+// @param profile is the profile of the new cluster
+// return the cluster hosting the jobs, or the error which prevented its creation after marking the jobs as failed
+func (p *Pool) deployOnNewCluster(d *model.QueuedDeployment, profile model.ClusterProfile) (model.ClusterBaseInterface,
+		error) {
 	clusterName := fmt.Sprintf("obi-%s", utils.RandomString(10))
-	cluster, err := newCluster(clusterName, "dataproc", highPerformance, autoscalingFactor)
+	p.reserveCluster(d, clusterName)
+	cluster, err := p.newCluster(clusterName, d.Platform, d.Infrastructure, d.Level, profile, d.AutoscalingFactor, d.Demand, false)
 
 	if err != nil {
-		for _, job := range jobs {
-			// Update job
-			job.Status = model.JobStatusFailed
-			persistent.Write(job)
+		for _, job := range d.Jobs {
+			failJob(job, fmt.Sprintf("creation of cluster %s failed: %s", clusterName, err))
 		}
-		return
+		return nil, err
+	}
+
+	submitJobs(cluster, d.Jobs)
+	return cluster, nil
+}
+
+// ReuseCluster is for deploying the list of jobs into an already running cluster
+// @param cluster is the running cluster which will host the jobs
+// @param jobs is the list of jobs to deploy
+// return false if the cluster is not running anymore, in which case no job was submitted
+func (s *Submitter) ReuseCluster(cluster model.ClusterBaseInterface, jobs []*model.Job) bool {
+	// Prevent the cluster from being released while the jobs are submitted
+	cluster.Lock()
+	defer cluster.Unlock()
+
+	if cluster.GetStatus() != model.ClusterStatusRunning {
+		return false
 	}
 
+	logrus.WithFields(logrus.Fields{
+		"clusterName": cluster.GetName(),
+		"jobs": len(jobs),
+	}).Info("Reusing running cluster")
+	submitJobs(cluster, jobs)
+	// The cluster may have been idle, it must not be released while running the new jobs
+	cluster.ResetIdleSince()
+	return true
+}
+
+func submitJobs(cluster model.ClusterBaseInterface, jobs []*model.Job) {
 	for _, job := range jobs {
 		// Update job status
 		job.Cluster = cluster
 		job.Status = model.JobStatusRunning
-		// Submit job for execution
-		cluster.SubmitJob(job)
+		// Submit job for execution, failing it if the platform rejects it since nothing would ever end it
+		if err := cluster.SubmitJob(job); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"jobID":       job.ID,
+				"clusterName": cluster.GetName(),
+				"error":       err,
+			}).Error("Job submission failed")
+			failJob(job, fmt.Sprintf("submission to cluster %s failed: %s", cluster.GetName(), err))
+			continue
+		}
 		// Update persistent storage
 		persistent.Write(job)
+		events.PublishJob(events.JobScheduled, job)
+	}
+}
+
+// failJob marks the job as failed for the given reason, recording whether it missed its deadline and, if it was
+// isolated as risky, its failure outcome
+// @param job is the failed job
+// @param reason describes why the job failed
+func failJob(job *model.Job, reason string) {
+	job.Status = model.JobStatusFailed
+	job.FailureReason = reason
+	job.CheckDeadline(utils.Now())
+	persistent.Write(job)
+	if outcome, ok := job.FailureOutcome(utils.Now()); ok {
+		persistent.Write(outcome)
 	}
+	events.PublishJob(events.JobFinished, job)
 }
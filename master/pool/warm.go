@@ -0,0 +1,215 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package pool
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"obi/master/autoscaler"
+	"obi/master/autoscaler/policies"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"sync"
+	"time"
+)
+
+// warmPool keeps a number of minimal clusters for each profile created in advance, so that jobs
+// can be deployed without waiting for the cluster creation. The warm clusters belong to the default infrastructure
+type warmPool struct {
+	config.WarmPool
+	creating map[string]int
+	sync.Mutex
+}
+
+// StartWarmPool starts the routine keeping the warm pool replenished, if any warm cluster is configured
+// @param c is the configuration of the warm pool
+func (p *Pool) StartWarmPool(c config.WarmPool) {
+	if len(c.Clusters) == 0 {
+		return
+	}
+	p.warm = &warmPool{
+		WarmPool: c,
+		creating: make(map[string]int),
+	}
+
+	logrus.Info("Starting warm pool routine.")
+	go warmPoolRoutine(p)
+}
+
+// ClaimWarmCluster is for taking an idle cluster of the given profile out of the warm pool
+// @param infrastructure is the name of the infrastructure the cluster must belong to
+// @param profile is the profile of the requested cluster
+// @param level is the scheduling level of the jobs which will run on the cluster
+// @param autoscalingFactor is the factor used from now on by the cluster autoscaler
+// return the claimed cluster, nil if the warm pool has no idle cluster for the profile
+func (p *Pool) ClaimWarmCluster(infrastructure string, profile model.ClusterProfile, level int32,
+		autoscalingFactor float32) model.ClusterBaseInterface {
+	if p.warm == nil {
+		return nil
+	}
+
+	var claimed model.ClusterBaseInterface
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		if cluster.GetInfrastructure() != infrastructure || cluster.GetProfile() != profile.Name ||
+			cluster.GetStatus() != model.ClusterStatusIdle {
+			return true
+		}
+
+		cluster.Lock()
+		defer cluster.Unlock()
+		if cluster.GetStatus() != model.ClusterStatusIdle {
+			return true
+		}
+		cluster.SetSchedulingLevel(level)
+		if metrics, ok := model.LastMetrics(cluster.GetMetricsWindow()); ok {
+			cluster.SetWarmCost(metrics.Cost)
+		}
+		cluster.SetStatus(model.ClusterStatusRunning)
+		claimed = cluster
+		return false
+	})
+	if claimed == nil {
+		return nil
+	}
+
+	if obj, ok := p.autoscalers.Load(claimed.GetName()); ok {
+		if autoscalingFactor == 0 {
+			autoscalingFactor = profile.Autoscaling.Factor
+		}
+		if policy, ok := policies.New(profile.Autoscaling.Policy, autoscalingFactor); ok {
+			obj.(*autoscaler.Autoscaler).SetPolicy(policy)
+		}
+	}
+	persistent.Write(claimed)
+	logrus.WithFields(logrus.Fields{
+		"clusterName": claimed.GetName(),
+		"profile":     profile.Name,
+	}).Info("Claimed warm cluster")
+
+	return claimed
+}
+
+// goroutine which periodically removes the expired warm clusters and creates the missing ones.
+// It will be stop when the `quit` channel is closed
+// @param pool contains the warm clusters
+func warmPoolRoutine(pool *Pool) {
+	for {
+		select {
+		case <-pool.quit:
+			logrus.Info("Closing warm pool routine.")
+			return
+		default:
+			pool.expireWarmClusters()
+			pool.replenishWarmPool()
+			time.Sleep(time.Duration(pool.warm.ReplenishInterval) * time.Second)
+		}
+	}
+}
+
+// expireWarmClusters releases the idle warm clusters older than the warm pool TTL
+func (p *Pool) expireWarmClusters() {
+	ttl := time.Duration(p.warm.TTL) * time.Second
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		if cluster.GetStatus() != model.ClusterStatusIdle ||
+			time.Now().Sub(cluster.GetCreationTimestamp()) < ttl {
+			return true
+		}
+
+		cluster.Lock()
+		if cluster.GetStatus() != model.ClusterStatusIdle {
+			cluster.Unlock()
+			return true
+		}
+		if metrics, ok := model.LastMetrics(cluster.GetMetricsWindow()); ok {
+			cluster.SetWarmCost(metrics.Cost)
+		}
+		cluster.SetStatus(model.ClusterStatusDeleting)
+		cluster.Unlock()
+
+		logrus.WithField("clusterName", cluster.GetName()).Info("Warm cluster expired")
+		p.RemoveCluster(cluster.GetName())
+		go cluster.FreeResources()
+		return true
+	})
+}
+
+// replenishWarmPool creates the clusters needed to reach the configured size of the warm pool
+func (p *Pool) replenishWarmPool() {
+	idle := make(map[string]int)
+	p.clusters.Range(func(key interface{}, value interface{}) bool {
+		cluster := value.(model.ClusterBaseInterface)
+		if cluster.GetStatus() == model.ClusterStatusIdle {
+			idle[cluster.GetProfile()]++
+		}
+		return true
+	})
+
+	p.warm.Lock()
+	defer p.warm.Unlock()
+	for profile, size := range p.warm.Clusters {
+		for i := idle[profile] + p.warm.creating[profile]; i < size; i++ {
+			p.warm.creating[profile]++
+			go p.createWarmCluster(profile)
+		}
+	}
+}
+
+// createWarmCluster allocates a new minimal cluster for the given profile and makes it idle
+func (p *Pool) createWarmCluster(profile string) {
+	defer func() {
+		p.warm.Lock()
+		p.warm.creating[profile]--
+		p.warm.Unlock()
+	}()
+
+	clusterProfile, ok := config.Get().ClusterProfile(profile)
+	if !ok {
+		logrus.WithField("profile", profile).Error("Unknown cluster profile for warm cluster")
+		return
+	}
+
+	infra, _ := config.Get().Infrastructure("")
+
+	// Warm clusters must not take the resources needed by the queued deployments
+	if !p.withinLimits(deploymentUsage(&model.QueuedDeployment{}, clusterProfile)) {
+		logrus.WithField("profile", profile).Info("Warm cluster not created because of the cluster limits")
+		return
+	}
+
+	clusterName := fmt.Sprintf("obi-warm-%s", utils.RandomString(10))
+	cluster, err := p.newCluster(clusterName, infra.Platform, infra.Name, -1, clusterProfile,
+		p.warm.AutoscalingFactor, model.ResourceDemand{}, true)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"profile": profile,
+			"error":   err,
+		}).Error("Could not create warm cluster")
+		return
+	}
+
+	cluster.Lock()
+	cluster.SetStatus(model.ClusterStatusIdle)
+	cluster.Unlock()
+	persistent.Write(cluster)
+
+	logrus.WithFields(logrus.Fields{
+		"clusterName": clusterName,
+		"profile":     profile,
+	}).Info("New warm cluster")
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"time"
+)
+
+// promoteAgedJobs moves the jobs which have been waiting in the level for longer than its aging
+// timeout to the level configured as aging target, recording each promotion
+func (s *Scheduler) promoteAgedJobs(ls *levelScheduler) {
+	target := ls.AgingTarget
+	if target <= ls.level {
+		target = ls.level + 1
+	}
+	reason := fmt.Sprintf("waited more than %d minutes in level %d", ls.AgingTimeout, ls.level)
+
+	for _, job := range ls.removeAgedJobs(time.Duration(ls.AgingTimeout) * time.Minute) {
+		logrus.WithFields(logrus.Fields{
+			"job":  job.ID,
+			"from": ls.level,
+			"to":   target,
+		}).Info("Promoting aged job")
+
+		job.Priority = target
+		persistent.Write(job)
+		persistent.Write(&model.JobPromotion{
+			JobID:     job.ID,
+			FromLevel: ls.level,
+			ToLevel:   target,
+			Reason:    reason,
+			Timestamp: utils.Now(),
+		})
+
+		s.ScheduleJob(job)
+	}
+}
+
+// removeAgedJobs removes from the bins and from the fair-share queues of the level the jobs
+// which have been waiting for longer than the given time
+// return the removed jobs
+func (ls *levelScheduler) removeAgedJobs(maxWait time.Duration) []*model.Job {
+	aged := func(job *model.Job) bool {
+		return utils.Now().Sub(job.ScheduleTimestamp) >= maxWait
+	}
+	var removed []*model.Job
+
+	ls.Lock()
+	for i := range ls.bins {
+		kept := bin{
+			creationTimestamp: ls.bins[i].creationTimestamp,
+			profile:           ls.bins[i].profile,
+			risky:             ls.bins[i].risky,
+		}
+		for _, job := range ls.bins[i].jobs {
+			if aged(job) {
+				removed = append(removed, job)
+			} else {
+				ls.addToBin(&kept, job)
+			}
+		}
+		ls.bins[i] = kept
+	}
+	// Drop the bins left empty
+	bins := ls.bins[:0]
+	for _, b := range ls.bins {
+		if len(b.jobs) > 0 {
+			bins = append(bins, b)
+		}
+	}
+	ls.bins = bins
+	ls.Unlock()
+
+	ls.fair.Lock()
+	for owner, queue := range ls.fair.queues {
+		var kept []*model.Job
+		for _, job := range queue {
+			if aged(job) {
+				removed = append(removed, job)
+			} else {
+				kept = append(kept, job)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ls.fair.queues, owner)
+		} else {
+			ls.fair.queues[owner] = kept
+		}
+	}
+	ls.fair.Unlock()
+
+	return removed
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"github.com/sirupsen/logrus"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"time"
+)
+
+// defaultProvisioningTime is the expected time needed to create a new cluster
+const defaultProvisioningTime = 120 * time.Second
+
+// expectedCompletion estimates when the job would complete if it was scheduled in the given level,
+// assuming that it waits for the whole level timeout before being deployed
+func (s *Scheduler) expectedCompletion(job *model.Job, level int32) time.Time {
+	var queueing time.Duration
+	if level < int32(len(s.levels)) {
+		queueing = time.Duration(s.levels[level].Timeout) * time.Second
+	}
+	duration := time.Duration(job.PredictedDuration) * time.Second
+	return utils.Now().Add(queueing + s.provisioningTime + duration)
+}
+
+// escalateForDeadline moves the job to the lowest level, starting from its current one, in which
+// it is expected to meet its deadline. If no level sharing clusters can make it, the job gets its
+// own cluster
+func (s *Scheduler) escalateForDeadline(job *model.Job) {
+	level := job.Priority
+	for level < int32(len(s.levels)) && s.expectedCompletion(job, level).After(job.Deadline) {
+		level++
+	}
+	if level == job.Priority {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"job":  job.ID,
+		"from": job.Priority,
+		"to":   level,
+	}).Info("Escalating job to meet its deadline")
+
+	persistent.Write(&model.JobPromotion{
+		JobID:     job.ID,
+		FromLevel: job.Priority,
+		ToLevel:   level,
+		Reason:    "the deadline could not be met waiting in the current level",
+		Timestamp: utils.Now(),
+	})
+	job.Priority = level
+	persistent.Write(job)
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/persistent"
+	"obi/master/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fairQueues holds the jobs waiting to be admitted into the bins of a fair-share level
+type fairQueues struct {
+	queues map[string][]*model.Job
+	usage  map[string]float64
+	// teams maps each user to its team, as read by the last usage refresh
+	teams      map[int]string
+	budget     int32
+	lastRefill time.Time
+	sync.Mutex
+}
+
+func newFairQueues() *fairQueues {
+	return &fairQueues{
+		queues: make(map[string][]*model.Job),
+		usage:  make(map[string]float64),
+		teams:  make(map[int]string),
+	}
+}
+
+// shareOwner returns the user or the team the job is accounted to
+func shareOwner(c *config.FairShare, job *model.Job, teams map[int]string) string {
+	if c.GroupBy == "team" {
+		// Configuration keys are case insensitive, so are team names
+		if team, ok := teams[job.Author]; ok && team != "" {
+			return strings.ToLower(team)
+		}
+	}
+	return strconv.Itoa(job.Author)
+}
+
+// ownerShare returns the weight of the given owner
+func ownerShare(c *config.FairShare, owner string) float64 {
+	if share, ok := c.Shares[owner]; ok && share > 0 {
+		return share
+	}
+	if c.DefaultShare > 0 {
+		return c.DefaultShare
+	}
+	return 1
+}
+
+// enqueue adds the job to the queue of its owner, waiting to be admitted into the bins. The team of the
+// owner is the one read by the last usage refresh
+func (ls *levelScheduler) enqueue(job *model.Job) {
+	ls.fair.Lock()
+	defer ls.fair.Unlock()
+	owner := shareOwner(&ls.FairShare, job, ls.fair.teams)
+	ls.fair.queues[owner] = append(ls.fair.queues[owner], job)
+}
+
+// refreshUsage reads from the persistent storage the recent usage of each owner and the teams of the
+// users, and restores the admission budget of the level
+func (ls *levelScheduler) refreshUsage() {
+	since := utils.Now().Add(-time.Duration(ls.FairShare.UsageWindow) * time.Second)
+	usage, err := persistent.GetUsageByAuthor(since)
+	if err != nil {
+		logrus.WithField("error", err).Warning("Could not read recent usage for fair-share scheduling")
+	}
+	var teams map[int]string
+	if ls.FairShare.GroupBy == "team" {
+		teams, err = persistent.GetUserTeams()
+		if err != nil {
+			logrus.WithField("error", err).Warning("Could not read user teams for fair-share scheduling")
+		}
+	}
+
+	ls.fair.Lock()
+	defer ls.fair.Unlock()
+	// Keep the previous teams if they could not be read
+	if teams != nil {
+		ls.fair.teams = teams
+	}
+	ls.fair.usage = make(map[string]float64)
+	for author, seconds := range usage {
+		ls.fair.usage[shareOwner(&ls.FairShare, &model.Job{Author: author}, ls.fair.teams)] += seconds
+	}
+	ls.fair.budget = ls.FairShare.JobsPerTimeout
+	ls.fair.lastRefill = utils.Now()
+}
+
+// admit moves the queued jobs into the bins, always picking the owner with the lowest usage
+// relative to its share, until the admission budget of the current timeout is exhausted
+func admit(s *Scheduler, ls *levelScheduler) {
+	if utils.Now().Sub(ls.fair.lastRefill) >= time.Duration(ls.Timeout)*time.Second {
+		ls.refreshUsage()
+	}
+
+	for {
+		job := ls.nextFairJob()
+		if job == nil {
+			return
+		}
+		addToLevel(s, ls, job)
+	}
+}
+
+// nextFairJob pops the next job to be admitted, nil if no job can be admitted now
+func (ls *levelScheduler) nextFairJob() *model.Job {
+	ls.fair.Lock()
+	defer ls.fair.Unlock()
+
+	if ls.FairShare.JobsPerTimeout > 0 && ls.fair.budget <= 0 {
+		return nil
+	}
+
+	selected := ""
+	var selectedScore float64
+	for owner, queue := range ls.fair.queues {
+		if len(queue) == 0 {
+			continue
+		}
+		score := ls.fair.usage[owner] / ownerShare(&ls.FairShare, owner)
+		if selected == "" || score < selectedScore {
+			selected = owner
+			selectedScore = score
+		}
+	}
+	if selected == "" {
+		return nil
+	}
+
+	job := ls.fair.queues[selected][0]
+	ls.fair.queues[selected] = ls.fair.queues[selected][1:]
+	if len(ls.fair.queues[selected]) == 0 {
+		delete(ls.fair.queues, selected)
+	}
+
+	// Account the admitted job as usage of its owner, so that the following choices take it into account
+	duration := float64(job.PredictedDuration)
+	if duration <= 0 {
+		duration = 1
+	}
+	ls.fair.usage[selected] += duration
+	ls.fair.budget--
+
+	return job
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"fmt"
+	"obi/master/config"
+	"obi/master/model"
+	"sort"
+)
+
+// binPacker exposes to the packing policies the level-specific notion of job size and bin capacity
+type binPacker interface {
+	// fit returns the space left in the bin if the job was added to it and whether the job fits at all,
+	// which it does not if it has an anti-affinity label in common with a job of the bin
+	fit(b *bin, job *model.Job) (float64, bool)
+	// weight returns the size of a job according to the level measure
+	weight(job *model.Job) float64
+	// place adds the job to the bin at the given index, opening a new bin if the index is negative
+	place(bins []bin, idx int, job *model.Job) []bin
+}
+
+// PackingPolicy defines the primitive methods that must be implemented for any type of bin-packing policy
+type PackingPolicy interface {
+	// SelectBin returns the index of the bin in which the job should be placed, chosen among the candidates
+	// of the job, or -1 to open a new bin
+	SelectBin(bins []bin, job *model.Job, p binPacker) int
+	// Repack is invoked before the given bins are deployed and may reorganize their jobs
+	Repack(bins []bin, p binPacker) []bin
+}
+
+// packingPolicies maps the policy names usable in the configuration to their constructors
+var packingPolicies = map[string]func() PackingPolicy{
+	"first-fit":            func() PackingPolicy { return &FirstFit{} },
+	"best-fit":             func() PackingPolicy { return &BestFit{} },
+	"worst-fit":            func() PackingPolicy { return &WorstFit{} },
+	"first-fit-decreasing": func() PackingPolicy { return &FirstFitDecreasing{} },
+}
+
+// defaultPackingPolicy is used by levels which do not specify any packing policy
+const defaultPackingPolicy = "first-fit"
+
+func init() {
+	config.AddValidator(func(c *config.Config) []error {
+		var errs []error
+		for i, level := range c.SchedulingLevels {
+			if _, err := NewPackingPolicy(level.Packing); err != nil {
+				errs = append(errs, fmt.Errorf("schedulingLevels[%d].packing: %s", i, err))
+			}
+		}
+		for _, name := range c.InfrastructureNames() {
+			for i, level := range c.Infrastructures[name].SchedulingLevels {
+				if _, err := NewPackingPolicy(level.Packing); err != nil {
+					errs = append(errs, fmt.Errorf("infrastructures.%s.schedulingLevels[%d].packing: %s", name, i, err))
+				}
+			}
+		}
+		return errs
+	})
+}
+
+// NewPackingPolicy returns the packing policy registered with the given name
+func NewPackingPolicy(name string) (PackingPolicy, error) {
+	if name == "" {
+		name = defaultPackingPolicy
+	}
+	constructor, ok := packingPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown packing policy '%s'", name)
+	}
+	return constructor(), nil
+}
+
+// candidates returns the indexes of the bins which a packing policy may choose for the job. When some
+// bins host jobs sharing an affinity label with it only those are eligible, so that a new bin is opened
+// rather than separating the job from them
+func candidates(bins []bin, job *model.Job) []int {
+	var all, affine []int
+	for i := range bins {
+		all = append(all, i)
+		for _, other := range bins[i].jobs {
+			if job.SharesAffinity(other) {
+				affine = append(affine, i)
+				break
+			}
+		}
+	}
+	if len(affine) > 0 {
+		return affine
+	}
+	return all
+}
+
+// FirstFit places each job in the first bin with enough space left
+type FirstFit struct{}
+
+// SelectBin is the implementation of the PackingPolicy interface
+func (*FirstFit) SelectBin(bins []bin, job *model.Job, p binPacker) int {
+	for _, i := range candidates(bins, job) {
+		if _, ok := p.fit(&bins[i], job); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// Repack is the implementation of the PackingPolicy interface
+func (*FirstFit) Repack(bins []bin, p binPacker) []bin {
+	return bins
+}
+
+// BestFit places each job in the bin which would be left with the least space after the insertion
+type BestFit struct{}
+
+// SelectBin is the implementation of the PackingPolicy interface
+func (*BestFit) SelectBin(bins []bin, job *model.Job, p binPacker) int {
+	selected := -1
+	var selectedResidual float64
+	for _, i := range candidates(bins, job) {
+		residual, ok := p.fit(&bins[i], job)
+		if ok && (selected < 0 || residual < selectedResidual) {
+			selected = i
+			selectedResidual = residual
+		}
+	}
+	return selected
+}
+
+// Repack is the implementation of the PackingPolicy interface
+func (*BestFit) Repack(bins []bin, p binPacker) []bin {
+	return bins
+}
+
+// WorstFit places each job in the bin which would be left with the most space after the insertion,
+// spreading the load evenly among the bins of a level
+type WorstFit struct{}
+
+// SelectBin is the implementation of the PackingPolicy interface
+func (*WorstFit) SelectBin(bins []bin, job *model.Job, p binPacker) int {
+	selected := -1
+	var selectedResidual float64
+	for _, i := range candidates(bins, job) {
+		residual, ok := p.fit(&bins[i], job)
+		if ok && (selected < 0 || residual > selectedResidual) {
+			selected = i
+			selectedResidual = residual
+		}
+	}
+	return selected
+}
+
+// Repack is the implementation of the PackingPolicy interface
+func (*WorstFit) Repack(bins []bin, p binPacker) []bin {
+	return bins
+}
+
+// FirstFitDecreasing behaves as FirstFit while jobs are submitted, but at flush time it packs again
+// all the jobs of the level starting from the biggest ones
+type FirstFitDecreasing struct {
+	FirstFit
+}
+
+// Repack is the implementation of the PackingPolicy interface
+func (f *FirstFitDecreasing) Repack(bins []bin, p binPacker) []bin {
+	var jobs []*model.Job
+	for i := range bins {
+		jobs = append(jobs, bins[i].jobs...)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return p.weight(jobs[i]) > p.weight(jobs[j])
+	})
+
+	var repacked []bin
+	for _, job := range jobs {
+		repacked = p.place(repacked, f.SelectBin(repacked, job, p), job)
+	}
+	return repacked
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"obi/master/config"
+	"obi/master/model"
+	"reflect"
+	"testing"
+)
+
+// job builds a synthetic job measured by its predicted duration
+func job(id int, duration int32) *model.Job {
+	return &model.Job{ID: id, PredictedDuration: duration}
+}
+
+// pack submits the jobs one by one to a time-based level with the given packing policy and capacity,
+// then repacks the bins as a flush would
+func pack(t *testing.T, policy string, capacity int32, jobs []*model.Job) []bin {
+	packer, err := NewPackingPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := model.BuiltinProfiles()
+	ls := &levelScheduler{
+		Level:   config.Level{Policy: config.MeasureTime, BinCapacity: capacity, Packing: policy},
+		packer:  packer,
+		profile: profiles[model.StandardProfile],
+		clusterProfile: func(name string) (model.ClusterProfile, bool) {
+			profile, ok := profiles[name]
+			return profile, ok
+		},
+	}
+
+	var bins []bin
+	for _, j := range jobs {
+		bins = ls.place(bins, ls.packer.SelectBin(bins, j, ls), j)
+	}
+	return ls.packer.Repack(bins, ls)
+}
+
+// assignment returns the IDs of the jobs of each bin
+func assignment(bins []bin) [][]int {
+	ids := make([][]int, 0, len(bins))
+	for _, b := range bins {
+		var jobs []int
+		for _, j := range b.jobs {
+			jobs = append(jobs, j.ID)
+		}
+		ids = append(ids, jobs)
+	}
+	return ids
+}
+
+func TestPackingPolicies(t *testing.T) {
+	// Jobs of 5, 7, 3 and 2 seconds in bins of 10 seconds are packed differently by every policy
+	synthetic := func() []*model.Job {
+		return []*model.Job{job(1, 5), job(2, 7), job(3, 3), job(4, 2)}
+	}
+
+	tests := []struct {
+		policy string
+		want   [][]int
+	}{
+		{"first-fit", [][]int{{1, 3, 4}, {2}}},
+		{"best-fit", [][]int{{1, 4}, {2, 3}}},
+		{"worst-fit", [][]int{{1, 3}, {2, 4}}},
+		{"first-fit-decreasing", [][]int{{2, 3}, {1, 4}}},
+		{"", [][]int{{1, 3, 4}, {2}}},
+	}
+	for _, tt := range tests {
+		if got := assignment(pack(t, tt.policy, 10, synthetic())); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got bins %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestPackingEdgeCases(t *testing.T) {
+	hp := job(2, 2)
+	hp.Profile = model.HighPerformanceProfile
+	conflicting := []*model.Job{job(1, 2), job(2, 2), job(3, 2)}
+	conflicting[0].AntiAffinity = []string{"table"}
+	conflicting[1].AntiAffinity = []string{"table"}
+	affine := []*model.Job{job(1, 6), job(2, 5), job(3, 2), job(4, 5)}
+	affine[0].Affinity = []string{"x"}
+	affine[2].Affinity = []string{"x"}
+	affine[3].Affinity = []string{"x"}
+
+	tests := []struct {
+		name string
+		jobs []*model.Job
+		want [][]int
+	}{
+		{"empty input", nil, [][]int{}},
+		// A job bigger than the capacity gets a bin of its own, which no other job can join
+		{"oversized jobs", []*model.Job{job(1, 15), job(2, 12), job(3, 3)}, [][]int{{1}, {2}, {3}}},
+		// Jobs requesting different profiles cannot share a cluster
+		{"profile mismatch", []*model.Job{job(1, 2), hp, job(3, 2)}, [][]int{{1, 3}, {2}}},
+		// Jobs sharing an anti-affinity label are never packed together
+		{"anti-affinity", conflicting, [][]int{{1, 3}, {2}}},
+		// Jobs sharing an affinity label only join each other, opening a new bin when theirs is full
+		{"affinity", affine, [][]int{{1, 3}, {2}, {4}}},
+	}
+	for _, policy := range []string{"first-fit", "best-fit", "worst-fit", "first-fit-decreasing"} {
+		for _, tt := range tests {
+			bins := pack(t, policy, 10, tt.jobs)
+			if got := assignment(bins); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s, %s: got bins %v, want %v", policy, tt.name, got, tt.want)
+			}
+			for _, b := range bins {
+				for _, j := range b.jobs {
+					if want := j.Profile; want != "" && b.profile.Name != want {
+						t.Errorf("%s, %s: job %d requesting profile %s packed in a %s bin", policy, tt.name, j.ID,
+							want, b.profile.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownPackingPolicy(t *testing.T) {
+	if _, err := NewPackingPolicy("next-fit"); err == nil {
+		t.Error("unknown packing policy accepted")
+	}
+}
@@ -17,29 +17,50 @@ package scheduling
 import (
 	"obi/master/model"
 	"github.com/sirupsen/logrus"
+	"math"
 		"obi/master/pool"
-	"github.com/spf13/viper"
+	"obi/master/config"
+	"obi/master/events"
+	"obi/master/utils"
 		"sync"
 	"time"
 	)
 
-type packingPolicy int
+// Measures of the size of a job when packing it into a bin
 const (
-	timeDuration packingPolicy = iota
-	count
+	timeDuration = config.MeasureTime
+	count = config.MeasureCount
+	resources = config.MeasureResources
 )
 
+// binCheckInterval is the interval at which the age of the bins is checked
+const binCheckInterval = 1 * time.Second
+
 type bin struct {
 	jobs []*model.Job
 	cumulativeValue int32
+	demand model.ResourceDemand
+	creationTimestamp time.Time
+	// profile of the cluster on which the jobs of the bin are deployed, shared by all of them
+	profile model.ClusterProfile
+	// risky tells whether the bin hosts jobs above the failure probability threshold of the level
+	risky bool
+}
+
+// age returns for how long the bin has been waiting since its first job was added
+func (b *bin) age() time.Duration {
+	return utils.Now().Sub(b.creationTimestamp)
 }
 
 type levelScheduler struct {
 	bins []bin
-	Policy packingPolicy
-	Timeout int32
-	BinCapacity int32
-	AutoscalingFactor float32
+	config.Level
+	level int32
+	packer PackingPolicy
+	fair *fairQueues
+	// profile is the cluster profile of the level, clusterProfile resolves the ones requested by the jobs
+	profile model.ClusterProfile
+	clusterProfile func(name string) (model.ClusterProfile, bool)
 	sync.RWMutex
 }
 
@@ -47,32 +68,74 @@ type levelScheduler struct {
 type Scheduler struct {
 	levels []levelScheduler
 	quit chan struct{}
+	pool *pool.Pool
 	submitter *pool.Submitter
 	autoscalingFactorOneJobOneCluster float32
 	autoscalingFactorOneJobOneClusterHP float32
+	profileOneJobOneCluster model.ClusterProfile
+	profileOneJobOneClusterHP model.ClusterProfile
+	clusterProfile func(name string) (model.ClusterProfile, bool)
+	provisioningTime time.Duration
+	deployments sync.WaitGroup
 }
 
 // New is the constructor for the scheduler struct
-func New(submitter *pool.Submitter) *Scheduler {
+// @param p is the pool in which the running clusters are looked for
+// @param submitter deploys the jobs of the flushed bins
+func New(p *pool.Pool, submitter *pool.Submitter) *Scheduler {
 	s := &Scheduler{
 		make([]levelScheduler, 0),
 		make(chan struct{}),
+		p,
 		submitter,
 		0,
 		0,
+		model.BuiltinProfiles()[model.StandardProfile],
+		model.BuiltinProfiles()[model.HighPerformanceProfile],
+		nil,
+		defaultProvisioningTime,
+		sync.WaitGroup{},
 	}
 	return s
 }
 
 // SetupConfig function load the configuration for the scheduler
-func (s *Scheduler) SetupConfig() {
-	err := viper.UnmarshalKey("schedulingLevels", &s.levels)
-	if err != nil {
-		logrus.WithField("err", err).Fatalln("Unable to configure the scheduler")
+// @param c is the validated configuration of the master
+func (s *Scheduler) SetupConfig(c *config.Config) {
+	s.setup(c, c.SchedulingLevels)
+}
+
+// SetupInfrastructure function load the configuration for the scheduler of an infrastructure
+// @param c is the validated configuration of the master
+// @param infra is the infrastructure whose scheduling levels are used
+func (s *Scheduler) SetupInfrastructure(c *config.Config, infra config.Infrastructure) {
+	s.setup(c, infra.SchedulingLevels)
+}
+
+func (s *Scheduler) setup(c *config.Config, levels []config.Level) {
+	var err error
+	s.levels = make([]levelScheduler, len(levels))
+	for i := range s.levels {
+		s.levels[i].Level = levels[i]
+		s.levels[i].level = int32(i)
+		s.levels[i].fair = newFairQueues()
+		s.levels[i].profile, _ = c.ClusterProfile(s.levels[i].Profile)
+		s.levels[i].clusterProfile = c.ClusterProfile
+		s.levels[i].packer, err = NewPackingPolicy(s.levels[i].Packing)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"level": i,
+				"err": err,
+			}).Fatalln("Unable to configure the scheduler")
+		}
 	}
 
-	s.autoscalingFactorOneJobOneCluster = float32(viper.GetFloat64("autoscalingFactorOneJobOneCluster"))
-	s.autoscalingFactorOneJobOneClusterHP = float32(viper.GetFloat64("autoscalingFactorOneJobOneClusterHP"))
+	s.autoscalingFactorOneJobOneCluster = c.AutoscalingFactorOneJobOneCluster
+	s.autoscalingFactorOneJobOneClusterHP = c.AutoscalingFactorOneJobOneClusterHP
+	s.profileOneJobOneCluster, _ = c.ClusterProfile(c.ProfileOneJobOneCluster)
+	s.profileOneJobOneClusterHP, _ = c.ClusterProfile(c.ProfileOneJobOneClusterHP)
+	s.clusterProfile = c.ClusterProfile
+	s.provisioningTime = time.Duration(c.ClusterProvisioningTime) * time.Second
 }
 
 // Start function starts the scheduling routine
@@ -80,7 +143,7 @@ func (s *Scheduler) Start() {
 	logrus.Info("Starting scheduling routine.")
 
 	for i := range s.levels {
-		go schedulingRoutine(&s.levels[i], s.submitter, s.quit)
+		go schedulingRoutine(s, &s.levels[i], s.quit)
 	}
 }
 
@@ -92,72 +155,353 @@ func (s *Scheduler) Stop() {
 
 // ScheduleJob if for adding a new job in the bins
 func (s *Scheduler) ScheduleJob(job *model.Job) {
+	if job.Priority < 0 {
+		logrus.WithFields(logrus.Fields{
+			"jobID": job.ID,
+			"priority": job.Priority,
+		}).Warning("Invalid priority, scheduling the job in the lowest level")
+		job.Priority = 0
+	} else if job.Priority > int32(len(s.levels))+1 {
+		logrus.WithFields(logrus.Fields{
+			"jobID": job.ID,
+			"priority": job.Priority,
+		}).Warning("Invalid priority, scheduling the job in the highest level")
+		job.Priority = int32(len(s.levels)) + 1
+	}
+	job.ScheduleTimestamp = utils.Now()
+	job.RiskIsolation = ""
+	if !job.Deadline.IsZero() {
+		s.escalateForDeadline(job)
+	}
 	if job.Priority == int32(len(s.levels)) {
-		go s.submitter.DeployJobs([]*model.Job{job}, false, s.autoscalingFactorOneJobOneCluster)
+		profile := s.jobProfile(job, s.profileOneJobOneCluster)
+		s.deploy(func() {
+			s.submitter.DeployJobs([]*model.Job{job}, job.Priority, profile,
+				s.autoscalingFactorOneJobOneCluster, job.Demand())
+		})
 	} else if job.Priority > int32(len(s.levels)) {
-		go s.submitter.DeployJobs([]*model.Job{job}, true, s.autoscalingFactorOneJobOneClusterHP)
+		profile := s.jobProfile(job, s.profileOneJobOneClusterHP)
+		s.deploy(func() {
+			s.submitter.DeployJobs([]*model.Job{job}, job.Priority, profile,
+				s.autoscalingFactorOneJobOneClusterHP, job.Demand())
+		})
+	} else if s.levels[job.Priority].FairShare.Enabled {
+		s.levels[job.Priority].enqueue(job)
 	} else {
-		schedulerLevel := &s.levels[job.Priority]
-		switch schedulerLevel.Policy {
-		case timeDuration:
-			timeDurationAddJob(schedulerLevel, job)
-		case count:
-			countAddJob(schedulerLevel, job)
-		}
+		addToLevel(s, &s.levels[job.Priority], job)
 	}
 	return
 }
 
-func timeDurationAddJob(ls *levelScheduler, job *model.Job) {
+// jobProfile returns the cluster profile requested by the job, or the given one if the job does not request any
+func (s *Scheduler) jobProfile(job *model.Job, fallback model.ClusterProfile) model.ClusterProfile {
+	return resolveProfile(s.clusterProfile, job, fallback)
+}
+
+// resolveProfile looks up the cluster profile requested by the job, falling back to the given one if the job
+// does not request any or the requested one is unknown
+func resolveProfile(lookup func(name string) (model.ClusterProfile, bool), job *model.Job,
+		fallback model.ClusterProfile) model.ClusterProfile {
+	if job.Profile == "" || lookup == nil {
+		return fallback
+	}
+	profile, ok := lookup(job.Profile)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"jobID": job.ID,
+			"profile": job.Profile,
+		}).Warning("Unknown cluster profile, using the default one")
+		return fallback
+	}
+	return profile
+}
+
+// deploy runs the given deployment in the background, keeping track of it until it returns
+func (s *Scheduler) deploy(f func()) {
+	s.deployments.Add(1)
+	go func() {
+		defer s.deployments.Done()
+		f()
+	}()
+}
+
+// Wait blocks until all the deployments started so far have returned
+func (s *Scheduler) Wait() {
+	s.deployments.Wait()
+}
+
+// Tick runs a single step of the scheduling routine of every level, without waiting for the check
+// interval. It is meant to drive the scheduler on a virtual clock, instead of calling Start
+func (s *Scheduler) Tick() {
+	for i := range s.levels {
+		s.tick(&s.levels[i])
+	}
+}
+
+// tick promotes the aged jobs of the level, admits the queued ones and flushes the expired bins
+func (s *Scheduler) tick(ls *levelScheduler) {
+	if ls.AgingTimeout > 0 {
+		s.promoteAgedJobs(ls)
+	}
+	if ls.FairShare.Enabled {
+		admit(s, ls)
+	}
+	flush(s, ls)
+}
+
+// addToLevel adds the job to the bins of the level, deploying the bin which hosts it if it became full
+func addToLevel(s *Scheduler, ls *levelScheduler, job *model.Job) {
+	if full := ls.addJob(job); full != nil {
+		logrus.WithField("priority-level", ls.level).Info("Bin is full, flushing it before the level timeout")
+		deployBin(s, ls, full, FlushReasonFull)
+	}
+}
+
+// addJob places the job into one of the level bins according to the level packing policy
+// return the bin which hosts the job if it became full and was removed from the level, nil otherwise
+func (ls *levelScheduler) addJob(job *model.Job) *bin {
 	ls.Lock()
 	defer ls.Unlock()
-	for i := range ls.bins {
-		jobFits := ls.bins[i].cumulativeValue + job.PredictedDuration <= ls.BinCapacity
-		jobTooLongButBinEmpty := ls.bins[i].cumulativeValue == 0 && job.PredictedDuration > ls.BinCapacity
-		if jobFits || jobTooLongButBinEmpty {
-			ls.bins[i].jobs = append(ls.bins[i].jobs, job)
-			ls.bins[i].cumulativeValue += job.PredictedDuration
-			return
+	idx := ls.packer.SelectBin(ls.bins, job, ls)
+	ls.bins = ls.place(ls.bins, idx, job)
+	if idx < 0 {
+		idx = len(ls.bins) - 1
+	}
+
+	if !ls.full(&ls.bins[idx]) {
+		return nil
+	}
+	full := ls.bins[idx]
+	ls.bins = append(ls.bins[:idx], ls.bins[idx+1:]...)
+	return &full
+}
+
+// full checks whether the bin reached the capacity of the level
+func (ls *levelScheduler) full(b *bin) bool {
+	// No job can join an isolated risky job, so there is no reason to wait
+	if b.risky && ls.riskIsolation() == model.RiskIsolate {
+		return true
+	}
+	if ls.Policy != resources {
+		return b.cumulativeValue >= ls.BinCapacity
+	}
+	saturated := func(value, capacity int32) bool {
+		return capacity > 0 && value >= capacity
+	}
+	return saturated(b.demand.MemoryMB, ls.MaxMemoryMB) ||
+		saturated(b.demand.VCores, ls.MaxVCores) ||
+		saturated(b.cumulativeValue, ls.BinCapacity)
+}
+
+// value returns the amount by which the job increases the cumulative value of a bin
+func (ls *levelScheduler) value(job *model.Job) int32 {
+	switch ls.Policy {
+	case count:
+		return 1
+	default:
+		return job.PredictedDuration
+	}
+}
+
+// demand returns the predicted resources of the job, using the level defaults for the unknown ones
+func (ls *levelScheduler) demand(job *model.Job) model.ResourceDemand {
+	d := job.Demand()
+	if d.MemoryMB <= 0 {
+		d.MemoryMB = ls.DefaultMemoryMB
+	}
+	if d.VCores <= 0 {
+		d.VCores = ls.DefaultVCores
+	}
+	return d
+}
+
+// weight is the implementation of the binPacker interface
+func (ls *levelScheduler) weight(job *model.Job) float64 {
+	if ls.Policy != resources {
+		return float64(ls.value(job))
+	}
+	// The size of a job is given by its most demanding dimension
+	d := ls.demand(job)
+	return math.Max(share(d.MemoryMB, ls.MaxMemoryMB),
+		math.Max(share(d.VCores, ls.MaxVCores), share(d.Duration, ls.BinCapacity)))
+}
+
+// jobProfile returns the cluster profile requested by the job, the one of the level if it does not request any
+func (ls *levelScheduler) jobProfile(job *model.Job) model.ClusterProfile {
+	return resolveProfile(ls.clusterProfile, job, ls.profile)
+}
+
+// fit is the implementation of the binPacker interface
+func (ls *levelScheduler) fit(b *bin, job *model.Job) (float64, bool) {
+	// Jobs requesting different profiles cannot share a cluster
+	if b.profile.Name != ls.jobProfile(job).Name {
+		return 0, false
+	}
+	if conflicts(b.jobs, job) {
+		return 0, false
+	}
+	// Risky jobs are either kept alone or packed only with each other
+	if b.risky != ls.risky(job) || (b.risky && ls.riskIsolation() == model.RiskIsolate) {
+		return 0, false
+	}
+
+	if ls.Policy != resources {
+		residual := float64(ls.BinCapacity) - float64(b.cumulativeValue) - ls.weight(job)
+		jobTooBigButBinEmpty := len(b.jobs) == 0 && ls.weight(job) > float64(ls.BinCapacity)
+		return residual, residual >= 0 || jobTooBigButBinEmpty
+	}
+
+	// Each dimension of the bin must be able to host the job; the residual space is the one of the
+	// dimension closest to saturation, as a fraction of its capacity
+	d := ls.demand(job)
+	residual := math.Min(1-share(b.demand.MemoryMB+d.MemoryMB, ls.MaxMemoryMB),
+		math.Min(1-share(b.demand.VCores+d.VCores, ls.MaxVCores),
+			1-share(b.cumulativeValue+ls.value(job), ls.BinCapacity)))
+	return residual, residual >= 0 || len(b.jobs) == 0
+}
+
+// place is the implementation of the binPacker interface
+func (ls *levelScheduler) place(bins []bin, idx int, job *model.Job) []bin {
+	if idx < 0 {
+		bins = append(bins, bin{creationTimestamp: utils.Now(), profile: ls.jobProfile(job), risky: ls.risky(job)})
+		idx = len(bins) - 1
+	}
+	ls.addToBin(&bins[idx], job)
+	return bins
+}
+
+// addToBin adds the job to the bin, updating its cumulative value and demand
+func (ls *levelScheduler) addToBin(b *bin, job *model.Job) {
+	if ls.risky(job) {
+		job.RiskIsolation = ls.riskIsolation()
+	}
+	b.jobs = append(b.jobs, job)
+	b.cumulativeValue += ls.value(job)
+	b.demand.Add(ls.demand(job))
+}
+
+// risky checks whether the predicted failure probability of the job requires failure-aware packing
+func (ls *levelScheduler) risky(job *model.Job) bool {
+	return ls.RiskThreshold > 0 && job.FailureProbability >= ls.RiskThreshold
+}
+
+// riskIsolation returns how the risky jobs of the level are packed
+func (ls *levelScheduler) riskIsolation() string {
+	if ls.RiskIsolation == "" {
+		return model.RiskIsolate
+	}
+	return ls.RiskIsolation
+}
+
+// conflicts checks whether the job has an anti-affinity label in common with any of the given jobs
+func conflicts(jobs []*model.Job, job *model.Job) bool {
+	for _, other := range jobs {
+		if job.ConflictsWith(other) {
+			return true
 		}
 	}
-	ls.bins = append(ls.bins, bin{})
-	ls.bins[len(ls.bins)-1].jobs = append(ls.bins[len(ls.bins)-1].jobs, job)
-	ls.bins[len(ls.bins)-1].cumulativeValue = job.PredictedDuration
+	return false
 }
 
-func countAddJob(ls *levelScheduler, job *model.Job) {
-	ls.Lock()
-	defer ls.Unlock()
-	for i := range ls.bins {
-		if ls.bins[i].cumulativeValue + 1 <= ls.BinCapacity {
-			ls.bins[i].jobs = append(ls.bins[i].jobs, job)
-			ls.bins[i].cumulativeValue++
-			return
+// share returns the fraction of the capacity taken by the given value, 0 if the capacity is unbounded
+func share(value, capacity int32) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return float64(value) / float64(capacity)
+}
+
+// deployBin submits the jobs of the bin to a running cluster of the same level with enough spare
+// capacity, if the level allows it, or to a new cluster otherwise
+// @param reason is why the bin was flushed, reported in the flush event
+func deployBin(s *Scheduler, ls *levelScheduler, b *bin, reason string) {
+	deployed := *b
+	s.deploy(func() {
+		if ls.ReuseClusters {
+			cluster := s.pool.FindCluster(func(c model.ClusterBaseInterface) bool {
+				return c.GetInfrastructure() == s.submitter.Infrastructure && ls.hasSpareCapacity(c, &deployed)
+			})
+			if cluster != nil && s.submitter.ReuseCluster(cluster, deployed.jobs) {
+				events.PublishFlush(s.submitter.Infrastructure, ls.level, deployed.jobs, cluster, true, false, reason)
+				return
+			}
+		}
+		cluster, err := s.submitter.DeployJobs(deployed.jobs, ls.level, deployed.profile, ls.AutoscalingFactor,
+			deployed.demand)
+		events.PublishFlush(s.submitter.Infrastructure, ls.level, deployed.jobs, cluster, false,
+			err == pool.ErrDeploymentQueued, reason)
+	})
+}
+
+// hasSpareCapacity checks whether a running cluster of the level with the profile of the bin can host its jobs,
+// according to its assigned jobs and to the resources available in its last heartbeat
+func (ls *levelScheduler) hasSpareCapacity(cluster model.ClusterBaseInterface, b *bin) bool {
+	if cluster.GetSchedulingLevel() != ls.level || cluster.GetStatus() != model.ClusterStatusRunning ||
+		cluster.GetProfile() != b.profile.Name {
+		return false
+	}
+
+	// Clusters without jobs can take follow-up work until the idle timeout of their profile releases them
+	assignedJobs := int32(cluster.GetAllocatedJobSlots())
+	if assignedJobs == 0 {
+		idleSince := cluster.GetIdleSince()
+		idleTimeout := time.Duration(b.profile.Lifecycle.IdleTimeout) * time.Second
+		if idleSince.IsZero() || utils.Now().Sub(idleSince) >= idleTimeout {
+			return false
+		}
+	}
+	if ls.MaxJobsPerCluster > 0 && assignedJobs+int32(len(b.jobs)) > ls.MaxJobsPerCluster {
+		return false
+	}
+	running := cluster.GetJobs()
+	for _, job := range b.jobs {
+		if conflicts(running, job) {
+			return false
 		}
 	}
-	ls.bins = append(ls.bins, bin{})
-	ls.bins[len(ls.bins)-1].jobs = append(ls.bins[len(ls.bins)-1].jobs, job)
-	ls.bins[len(ls.bins)-1].cumulativeValue = 1
+
+	metrics, ok := model.LastMetrics(cluster.GetMetricsWindow())
+	if !ok {
+		return false
+	}
+	return metrics.PendingContainers == 0 &&
+		metrics.AvailableMB >= b.demand.MemoryMB &&
+		metrics.AvailableVCores >= b.demand.VCores
 }
 
-func flush(ls *levelScheduler, s *pool.Submitter) {
+// flush deploys the bins which have been waiting for longer than the level timeout
+func flush(s *Scheduler, ls *levelScheduler) {
 	ls.Lock()
 	defer ls.Unlock()
-	for i := range ls.bins {
-		go s.DeployJobs(ls.bins[i].jobs, false, ls.AutoscalingFactor)
+
+	var expired, waiting []bin
+	for _, b := range ls.bins {
+		if b.age() >= time.Duration(ls.Timeout)*time.Second {
+			expired = append(expired, b)
+		} else {
+			waiting = append(waiting, b)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	expired = ls.packer.Repack(expired, ls)
+	for i := range expired {
+		deployBin(s, ls, &expired[i], FlushReasonTimeout)
 	}
-	ls.bins = nil
+	ls.bins = waiting
 }
 
-func schedulingRoutine(ls *levelScheduler, s *pool.Submitter, quit <-chan struct{}) {
+func schedulingRoutine(s *Scheduler, ls *levelScheduler, quit <-chan struct{}) {
 	for {
 		select {
 		case <-quit:
 			logrus.Info("Closing level-scheduler routine.")
 			return
 		default:
-			flush(ls, s)
+			s.tick(ls)
 		}
-		time.Sleep(time.Duration(ls.Timeout) * time.Second)
+		time.Sleep(binCheckInterval)
 	}
 }
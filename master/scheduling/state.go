@@ -0,0 +1,103 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package scheduling
+
+import (
+	"obi/master/config"
+	"obi/master/model"
+	"time"
+)
+
+// Reasons for which a bin is flushed
+const (
+	FlushReasonFull    = "full"
+	FlushReasonTimeout = "timeout"
+)
+
+// LevelState is a snapshot of a scheduling level
+type LevelState struct {
+	Level       int32
+	Policy      string
+	Packing     string
+	Timeout     int32
+	BinCapacity int32
+	MaxMemoryMB int32
+	MaxVCores   int32
+	Profile     string
+	// NextFlush is when the oldest bin of the level will be flushed, zero if the level has no bins
+	NextFlush time.Time
+	Bins      []BinState
+	// QueuedJobs is the number of jobs waiting to be admitted into the bins of a fair-share level
+	QueuedJobs int
+}
+
+// BinState is a snapshot of a bin waiting to be flushed
+type BinState struct {
+	Jobs              []*model.Job
+	CumulativeValue   int32
+	Demand            model.ResourceDemand
+	CreationTimestamp time.Time
+	Profile           string
+}
+
+// State returns a snapshot of all the scheduling levels with their bins
+func (s *Scheduler) State() []LevelState {
+	states := make([]LevelState, len(s.levels))
+	for i := range s.levels {
+		states[i] = s.levels[i].state()
+	}
+	return states
+}
+
+func (ls *levelScheduler) state() LevelState {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	state := LevelState{
+		Level:       ls.level,
+		Policy:      config.BinMeasureNames[ls.Policy],
+		Packing:     ls.Packing,
+		Timeout:     ls.Timeout,
+		BinCapacity: ls.BinCapacity,
+		MaxMemoryMB: ls.MaxMemoryMB,
+		MaxVCores:   ls.MaxVCores,
+		Profile:     ls.profile.Name,
+	}
+	if state.Packing == "" {
+		state.Packing = defaultPackingPolicy
+	}
+
+	for _, b := range ls.bins {
+		state.Bins = append(state.Bins, BinState{
+			append([]*model.Job(nil), b.jobs...),
+			b.cumulativeValue,
+			b.demand,
+			b.creationTimestamp,
+			b.profile.Name,
+		})
+		flushTime := b.creationTimestamp.Add(time.Duration(ls.Timeout) * time.Second)
+		if state.NextFlush.IsZero() || flushTime.Before(state.NextFlush) {
+			state.NextFlush = flushTime
+		}
+	}
+
+	ls.fair.Lock()
+	for _, queue := range ls.fair.queues {
+		state.QueuedJobs += len(queue)
+	}
+	ls.fair.Unlock()
+
+	return state
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+// The simulator replays a job trace exported from the Job table through the OBI scheduler, submitter and
+// autoscaling policies. Clusters are created on a simulated platform and time only advances on a virtual
+// clock, so a new configuration can be evaluated in a few seconds without creating any real cluster.
+package main
+
+import (
+	"flag"
+	"github.com/sirupsen/logrus"
+	"obi/master/config"
+	"obi/master/model"
+	"obi/master/platforms"
+	"obi/master/pool"
+	"obi/master/scheduling"
+	"obi/master/utils"
+	"os"
+	"time"
+)
+
+func parseConfig(configPath string) *config.Config {
+	c, err := config.Load(configPath, nil)
+	if err != nil {
+		logrus.WithField("err", err).Fatalln("Unable to read configuration")
+	}
+	errs := c.Validate()
+	for _, err := range errs {
+		logrus.WithField("err", err).Error("Invalid configuration")
+	}
+	if len(errs) > 0 {
+		logrus.Fatalln("Unable to simulate an invalid configuration")
+	}
+
+	platforms.Configure(c)
+	return c
+}
+
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_PATH"), "OBI master configuration to evaluate")
+	tracePath := flag.String("trace", "", "CSV trace of jobs exported from the Job table")
+	step := flag.Duration("step", 10*time.Second, "virtual time between two simulation steps")
+	horizon := flag.Duration("horizon", 30*24*time.Hour,
+		"virtual time after the last submission at which the simulation is interrupted")
+	verbose := flag.Bool("verbose", false, "show the logs of the simulated components")
+	flag.Parse()
+
+	logrus.SetOutput(os.Stderr)
+	if !*verbose {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+
+	c := parseConfig(*configPath)
+	trace, err := readTrace(*tracePath)
+	if err != nil {
+		logrus.WithField("error", err).Fatalln("Unable to read the trace")
+	}
+	if len(trace) == 0 {
+		logrus.Fatalln("The trace contains no job")
+	}
+
+	runtimes := make(map[*model.Job]time.Duration)
+	for _, tj := range trace {
+		runtimes[tj.job] = tj.runtime
+	}
+	platforms.Simulation.Runtime = func(job *model.Job) time.Duration {
+		return runtimes[job]
+	}
+
+	clock := utils.NewVirtualClock(trace[0].job.CreationTimestamp)
+	utils.SetClock(clock)
+
+	// The default infrastructure is simulated
+	infra, _ := c.Infrastructure("")
+	clusters := pool.New()
+	submitter := pool.NewSubmitter(clusters, infra)
+	submitter.Platform = "simulated"
+	scheduler := scheduling.New(clusters, submitter)
+	scheduler.SetupInfrastructure(c, infra)
+
+	end := run(scheduler, clusters, clock, trace, *step, trace[len(trace)-1].job.CreationTimestamp.Add(*horizon))
+	printReport(os.Stdout, trace, end)
+}
+
+// run drives the scheduler, the simulated clusters and their autoscalers until all the jobs of the trace
+// have ended or the given time is reached
+// return the virtual time at which the simulation ended
+func run(scheduler *scheduling.Scheduler, clusters *pool.Pool, clock *utils.VirtualClock, trace []*traceJob,
+		step time.Duration, limit time.Time) time.Time {
+	lastScaling := make(map[string]time.Time)
+	next := 0
+
+	for next < len(trace) || !ended(trace) {
+		now := clock.Now()
+		if now.After(limit) {
+			logrus.WithField("time", now).Warning("Simulation interrupted before all the jobs ended")
+			break
+		}
+
+		for ; next < len(trace) && !trace[next].job.CreationTimestamp.After(now); next++ {
+			scheduler.ScheduleJob(trace[next].job)
+		}
+		scheduler.Tick()
+		scheduler.Wait()
+		clusters.ReleaseQueued()
+		clusters.WaitDeployments()
+
+		clock.Advance(step)
+		now = clock.Now()
+		for _, cluster := range platforms.SimulatedClusters() {
+			if cluster.GetStatus() != model.ClusterStatusClosed {
+				cluster.Step(now)
+			}
+		}
+		clusters.EnforceLifecycle()
+		clusters.WaitReleases()
+		for _, cluster := range platforms.SimulatedClusters() {
+			if cluster.GetStatus() == model.ClusterStatusClosed {
+				if _, ok := clusters.GetCluster(cluster.GetName()); ok {
+					clusters.RemoveCluster(cluster.GetName())
+				}
+				continue
+			}
+
+			a, ok := clusters.GetAutoscaler(cluster.GetName())
+			if !ok {
+				continue
+			}
+			if _, ok := lastScaling[cluster.GetName()]; !ok {
+				lastScaling[cluster.GetName()] = cluster.GetCreationTimestamp()
+			}
+			if now.Sub(lastScaling[cluster.GetName()]) >= time.Duration(a.Timeout)*time.Second {
+				a.Step()
+				lastScaling[cluster.GetName()] = now
+			}
+		}
+	}
+
+	return clock.Now()
+}
+
+// ended checks whether all the jobs of the trace either completed or failed
+func ended(trace []*traceJob) bool {
+	for _, tj := range trace {
+		if tj.job.Status != model.JobStatusCompleted && tj.job.Status != model.JobStatusFailed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"obi/master/model"
+	"obi/master/platforms"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// levelStats aggregates the outcome of the jobs submitted to the same scheduling level
+type levelStats struct {
+	jobs      int
+	completed int
+	failed    int
+	// queueing delays between the submission of the jobs and the start of their execution
+	delays []time.Duration
+	// slowdowns are the ratios between the response time of the jobs and their runtime
+	slowdowns []float64
+	deadlines int
+	missed    int
+}
+
+// printReport writes the cluster usage and the per-level job statistics of the simulation
+// @param w is where the report is written
+// @param trace is the replayed trace
+// @param end is the virtual time at which the simulation ended
+func printReport(w io.Writer, trace []*traceJob, end time.Time) {
+	var hours float64
+	var cost float32
+	clusters := platforms.SimulatedClusters()
+	runs := make(map[*model.Job]*platforms.SimulatedRun)
+	for _, cluster := range clusters {
+		hours += cluster.Hours(end)
+		cost += cluster.GetCost()
+		for _, run := range cluster.Runs() {
+			runs[run.Job] = run
+		}
+	}
+
+	stats := make(map[int32]*levelStats)
+	for _, tj := range trace {
+		s, ok := stats[tj.level]
+		if !ok {
+			s = &levelStats{}
+			stats[tj.level] = s
+		}
+		s.jobs++
+		if !tj.job.Deadline.IsZero() {
+			s.deadlines++
+		}
+		if tj.job.DeadlineMissed {
+			s.missed++
+		}
+
+		run, ok := runs[tj.job]
+		if !ok || tj.job.Status == model.JobStatusFailed {
+			s.failed++
+			continue
+		}
+		if run.Start.IsZero() {
+			continue
+		}
+		s.delays = append(s.delays, run.Start.Sub(tj.job.CreationTimestamp))
+		if tj.job.Status != model.JobStatusCompleted {
+			continue
+		}
+		s.completed++
+		if tj.runtime > 0 {
+			s.slowdowns = append(s.slowdowns, float64(run.End.Sub(tj.job.CreationTimestamp))/float64(tj.runtime))
+		}
+	}
+
+	fmt.Fprintf(w, "Simulated time:  %s\n", end.Sub(trace[0].job.CreationTimestamp).Round(time.Second))
+	fmt.Fprintf(w, "Clusters:        %d\n", len(clusters))
+	fmt.Fprintf(w, "Cluster-hours:   %.2f\n", hours)
+	fmt.Fprintf(w, "Estimated cost:  $%.2f\n\n", cost)
+
+	levels := make([]int32, 0, len(stats))
+	for level := range stats {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "level\tjobs\tcompleted\tfailed\tmean delay\tp95 delay\tmax delay\t"+
+		"mean slowdown\tp95 slowdown\tmissed deadlines\t")
+	for _, level := range levels {
+		s := stats[level]
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%s\t%s\t%.2f\t%.2f\t%d/%d\t\n",
+			level, s.jobs, s.completed, s.failed,
+			meanDuration(s.delays), percentileDuration(s.delays, 0.95), percentileDuration(s.delays, 1),
+			mean(s.slowdowns), percentile(s.slowdowns, 0.95), s.missed, s.deadlines)
+	}
+	tw.Flush()
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the smallest value greater or equal than the given fraction of the values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func meanDuration(values []time.Duration) time.Duration {
+	return time.Duration(mean(durationsToFloat(values))).Round(time.Second)
+}
+
+func percentileDuration(values []time.Duration, p float64) time.Duration {
+	return time.Duration(percentile(durationsToFloat(values), p)).Round(time.Second)
+}
+
+func durationsToFloat(values []time.Duration) []float64 {
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		floats[i] = float64(v)
+	}
+	return floats
+}
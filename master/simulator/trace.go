@@ -0,0 +1,169 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"obi/master/model"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the formats accepted for the timestamps of the trace, the first one is the
+// format used by PostgreSQL when exporting a timestamp column to CSV
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07",
+	time.RFC3339Nano,
+}
+
+// traceJob is a job of the trace together with its recorded execution time
+type traceJob struct {
+	job *model.Job
+	// level is the scheduling level the job was submitted to
+	level int32
+	// runtime is how long the job took to run once it was deployed
+	runtime time.Duration
+}
+
+// readTrace reads the jobs of a CSV trace exported from the Job table, sorted by submission time.
+// The columns are matched by name, case insensitively: creationtimestamp, priority and runtime (in seconds)
+// are required, while id, author, predictedduration, predictedmemorymb, predictedvcores,
+// failureprobability, deadline, profile, affinity and antiaffinity are optional. Affinity labels are
+// separated by commas
+// @param path is the location of the trace file
+func readTrace(path string) ([]*traceJob, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the trace header: %s", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"creationtimestamp", "priority", "runtime"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the trace has no '%s' column", name)
+		}
+	}
+
+	var jobs []*traceJob
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tj, err := parseTraceRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of the trace: %s", line, err)
+		}
+		if tj.job.ID == 0 {
+			tj.job.ID = len(jobs) + 1
+		}
+		jobs = append(jobs, tj)
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].job.CreationTimestamp.Before(jobs[j].job.CreationTimestamp)
+	})
+	return jobs, nil
+}
+
+// parseTraceRecord builds the job described by a line of the trace
+func parseTraceRecord(record []string, columns map[string]int) (*traceJob, error) {
+	field := func(name string) string {
+		if idx, ok := columns[name]; ok && idx < len(record) {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+	number := func(name string) (float64, error) {
+		if field(name) == "" {
+			return 0, nil
+		}
+		value, err := strconv.ParseFloat(field(name), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s '%s'", name, field(name))
+		}
+		return value, nil
+	}
+
+	job := &model.Job{
+		Type:   model.JobTypePySpark,
+		Status: model.JobStatusPending,
+	}
+	var err error
+	if job.CreationTimestamp, err = parseTimestamp(field("creationtimestamp")); err != nil {
+		return nil, err
+	}
+	job.Profile = field("profile")
+	if field("affinity") != "" {
+		job.Affinity = strings.Split(field("affinity"), ",")
+	}
+	if field("antiaffinity") != "" {
+		job.AntiAffinity = strings.Split(field("antiaffinity"), ",")
+	}
+	if field("deadline") != "" {
+		if job.Deadline, err = parseTimestamp(field("deadline")); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make(map[string]float64)
+	for _, name := range []string{"id", "author", "priority", "runtime", "predictedduration",
+		"predictedmemorymb", "predictedvcores", "failureprobability"} {
+		if values[name], err = number(name); err != nil {
+			return nil, err
+		}
+	}
+	job.ID = int(values["id"])
+	job.Author = int(values["author"])
+	job.Priority = int32(values["priority"])
+	job.PredictedDuration = int32(values["predictedduration"])
+	job.PredictedMemoryMB = int32(values["predictedmemorymb"])
+	job.PredictedVCores = int32(values["predictedvcores"])
+	job.FailureProbability = float32(values["failureprobability"])
+
+	return &traceJob{
+		job,
+		job.Priority,
+		time.Duration(values["runtime"] * float64(time.Second)),
+	}, nil
+}
+
+// parseTimestamp parses a timestamp of the trace in any of the accepted layouts
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%s'", value)
+}
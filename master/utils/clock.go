@@ -0,0 +1,72 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time, which can be replaced to run the system on a virtual time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clock used by the whole process, the system one unless replaced through SetClock
+var clock Clock = systemClock{}
+
+// Now returns the current time according to the clock in use
+func Now() time.Time {
+	return clock.Now()
+}
+
+// SetClock replaces the clock used by the whole process
+// @param c is the new clock
+func SetClock(c Clock) {
+	clock = c
+}
+
+// VirtualClock is a clock whose time only moves forward when explicitly advanced
+type VirtualClock struct {
+	sync.RWMutex
+	now time.Time
+}
+
+// NewVirtualClock creates a new virtual clock
+// @param start is the initial time of the clock
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now returns the current virtual time
+func (c *VirtualClock) Now() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.now
+}
+
+// Advance moves the virtual time forward
+// @param d is the amount of time to add to the clock
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"obi/master/events"
+	"obi/master/model"
+	"obi/master/persistent"
+	"strconv"
+	"time"
+)
+
+// requestUser returns the identifier of the user issuing the request
+func requestUser(ctx context.Context) (int, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md["userid"]) == 0 {
+		return 0, status.Errorf(codes.PermissionDenied, "Missing credentials")
+	}
+	userID, _ := strconv.Atoi(md["userid"][0])
+	return userID, nil
+}
+
+// newWebhook checks a webhook subscription request and builds the corresponding webhook
+// @param request is the subscription
+// @param userID is the identifier of the user subscribing
+// @param jobID is the identifier of the job whose events are delivered, 0 for all the jobs of the user
+func newWebhook(request *WebhookRequest, userID int, jobID int) (*model.Webhook, error) {
+	u, err := url.Parse(request.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid webhook URL '%s'", request.Url)
+	}
+	if request.Secret == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "A secret is required to sign the webhook payloads")
+	}
+
+	webhook := &model.Webhook{
+		UserID:    userID,
+		JobID:     jobID,
+		URL:       request.Url,
+		Secret:    request.Secret,
+		Events:    request.Events,
+		Timestamp: time.Now(),
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = []string{string(events.JobFinished)}
+	}
+	for _, name := range webhook.Events {
+		known := false
+		for _, t := range events.Types {
+			if string(t) == name {
+				known = true
+			}
+		}
+		if !known {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown event type '%s'", name)
+		}
+	}
+	return webhook, nil
+}
+
+// AddWebhook remote procedure call used to subscribe a webhook to the events of all the jobs of the user,
+// or of one of them
+func (m *ObiMaster) AddWebhook(ctx context.Context, request *WebhookRequest) (*WebhookResponse, error) {
+	userID, err := requestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.JobID != 0 {
+		author, err := persistent.GetJobAuthor(int(request.JobID))
+		if err != nil || author != userID {
+			return nil, status.Errorf(codes.NotFound, "Job %d not found", request.JobID)
+		}
+	}
+
+	webhook, err := newWebhook(request, userID, int(request.JobID))
+	if err != nil {
+		return nil, err
+	}
+	if err := persistent.Write(webhook); err != nil {
+		logrus.WithField("error", err).Error("Could not store webhook")
+		return nil, status.Errorf(codes.Internal, "Could not store webhook")
+	}
+
+	return &WebhookResponse{WebhookID: int32(webhook.ID)}, nil
+}
+
+// ListWebhooks remote procedure call used to list the webhooks of the user, without their secrets
+func (m *ObiMaster) ListWebhooks(ctx context.Context, request *ListWebhooksRequest) (*ListWebhooksResponse,
+		error) {
+	userID, err := requestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := persistent.GetWebhooks(userID)
+	if err != nil {
+		logrus.WithField("error", err).Error("Could not load webhooks")
+		return nil, status.Errorf(codes.Internal, "Could not load webhooks")
+	}
+
+	response := &ListWebhooksResponse{}
+	for _, webhook := range webhooks {
+		response.Webhooks = append(response.Webhooks, &WebhookInfo{
+			WebhookID: int32(webhook.ID),
+			Url:       webhook.URL,
+			Events:    webhook.Events,
+			JobID:     int32(webhook.JobID),
+			Timestamp: webhook.Timestamp.Unix(),
+		})
+	}
+	return response, nil
+}
+
+// DeleteWebhook remote procedure call used to remove a webhook of the user, dropping its pending deliveries
+func (m *ObiMaster) DeleteWebhook(ctx context.Context, request *DeleteWebhookRequest) (*WebhookResponse, error) {
+	userID, err := requestUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := persistent.DeleteWebhook(int(request.WebhookID), userID)
+	if err != nil {
+		logrus.WithField("error", err).Error("Could not delete webhook")
+		return nil, status.Errorf(codes.Internal, "Could not delete webhook")
+	}
+	if !deleted {
+		return nil, status.Errorf(codes.NotFound, "Webhook %d not found", request.WebhookID)
+	}
+	return &WebhookResponse{WebhookID: request.WebhookID}, nil
+}
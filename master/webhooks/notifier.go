@@ -0,0 +1,294 @@
+// Copyright 2018 Delivery Hero Germany
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//     Unless required by applicable law or agreed to in writing, software
+//     distributed under the License is distributed on an "AS IS" BASIS,
+//     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//     See the License for the specific language governing permissions and
+//     limitations under the License.
+
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"obi/master/config"
+	"obi/master/events"
+	"obi/master/model"
+	"obi/master/persistent"
+	"time"
+)
+
+// SignatureHeader is the HTTP header carrying the signature of the payload: "sha256=" followed by the
+// hexadecimal HMAC-SHA256 of the body, keyed with the secret of the webhook
+const SignatureHeader = "X-Obi-Signature"
+
+// EventHeader is the HTTP header carrying the type of the event, e.g. "job-finished"
+const EventHeader = "X-Obi-Event"
+
+// outboxCheckInterval is the interval at which the outbox is checked for deliveries to retry
+const outboxCheckInterval = 10 * time.Second
+
+// outboxBatch is the maximum number of deliveries tried at each check of the outbox
+const outboxBatch = 100
+
+// Payload is the JSON body delivered to the webhooks
+type Payload struct {
+	Event string `json:"event"`
+	// Timestamp is the time of the event in seconds since the Unix epoch
+	Timestamp   int64  `json:"timestamp"`
+	JobID       int    `json:"jobId,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+	// Status is the status of the job, or of the cluster for the cluster events
+	Status string `json:"status,omitempty"`
+	// DriverOutputURI is the location of the output of the driver of a finished job
+	DriverOutputURI string `json:"driverOutputUri,omitempty"`
+	// Reason explains why a finished job was failed by OBI, e.g. because its cluster reached its maximum lifetime
+	Reason           string `json:"reason,omitempty"`
+	WorkerNodes      int32  `json:"workerNodes,omitempty"`
+	PreemptibleNodes int32  `json:"preemptibleNodes,omitempty"`
+	// Text summarizes the event, for chat services such as Slack
+	Text string `json:"text"`
+}
+
+// Notifier turns the events of the jobs into webhook deliveries, stored in a durable outbox until
+// they succeed or run out of attempts
+type Notifier struct {
+	config.Webhooks
+	client *http.Client
+	wake   chan struct{}
+	quit   chan struct{}
+}
+
+// New is the constructor of the webhook Notifier struct
+// @param c is the configuration of the deliveries
+// return the pointer to the instance
+func New(c config.Webhooks) *Notifier {
+	return &Notifier{
+		Webhooks: c,
+		client:   &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start the execution of the notifier
+func (n *Notifier) Start() {
+	logrus.Info("Starting webhook notifier routines.")
+	// Every event must reach the outbox, however long storing the previous ones takes
+	subscription, unsubscribe := events.SubscribeReliable(events.Filter{})
+	go subscriptionRoutine(n, subscription, unsubscribe)
+	go deliveryRoutine(n)
+}
+
+// Stop the execution of the notifier routines
+func (n *Notifier) Stop() {
+	close(n.quit)
+}
+
+// Sign computes the signature of a payload
+// @param secret is the secret of the webhook
+// @param payload is the body of the delivery
+// return the hexadecimal HMAC-SHA256 of the payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// goroutine which stores in the outbox a delivery for each webhook subscribed to the published events.
+// It will be stop when the `quit` channel is closed
+// @param n is the notifier
+// @param subscription is the channel on which the events are received
+// @param unsubscribe stops the subscription
+func subscriptionRoutine(n *Notifier, subscription <-chan events.Event, unsubscribe func()) {
+	defer unsubscribe()
+	for {
+		select {
+		case <-n.quit:
+			logrus.Info("Closing webhook subscription routine.")
+			return
+		case event, ok := <-subscription:
+			if !ok {
+				return
+			}
+			if n.enqueue(event) {
+				n.signal()
+			}
+		}
+	}
+}
+
+// goroutine which delivers the payloads of the outbox as soon as they are stored and retries the failed
+// ones when they are due. It will be stop when the `quit` channel is closed
+// @param n is the notifier
+func deliveryRoutine(n *Notifier) {
+	ticker := time.NewTicker(outboxCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.quit:
+			logrus.Info("Closing webhook delivery routine.")
+			return
+		case <-n.wake:
+		case <-ticker.C:
+		}
+		n.deliverDue()
+	}
+}
+
+// signal wakes up the delivery routine, without waiting for it
+func (n *Notifier) signal() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue stores a delivery for each webhook subscribed to the event, for any of the jobs it concerns
+// return true if some delivery was stored
+func (n *Notifier) enqueue(event events.Event) bool {
+	stored := false
+	seen := make(map[int]bool)
+	for _, job := range event.Jobs {
+		webhooks, err := persistent.GetJobWebhooks(job.Author, job.ID)
+		if err != nil {
+			logrus.WithField("error", err).Error("Unable to load webhooks from database")
+			return stored
+		}
+
+		for _, webhook := range webhooks {
+			if seen[webhook.ID] || !webhook.Subscribes(string(event.Type)) {
+				continue
+			}
+			seen[webhook.ID] = true
+
+			payload, err := json.Marshal(newPayload(event, job))
+			if err != nil {
+				logrus.WithField("error", err).Error("Unable to encode webhook payload")
+				continue
+			}
+			err = persistent.Write(&model.WebhookDelivery{
+				WebhookID:   webhook.ID,
+				Event:       string(event.Type),
+				Payload:     payload,
+				NextAttempt: time.Now(),
+			})
+			if err != nil {
+				logrus.WithField("error", err).Error("Unable to store webhook delivery")
+				continue
+			}
+			stored = true
+		}
+	}
+	return stored
+}
+
+// newPayload describes the event for the webhooks of the given job
+func newPayload(event events.Event, job *model.Job) *Payload {
+	payload := &Payload{
+		Event:            string(event.Type),
+		Timestamp:        event.Timestamp.Unix(),
+		JobID:            job.ID,
+		ClusterName:      event.ClusterName,
+		Status:           event.Status,
+		WorkerNodes:      event.WorkerNodes,
+		PreemptibleNodes: event.PreemptibleNodes,
+	}
+	if event.JobID != 0 {
+		payload.Text = fmt.Sprintf("OBI job %d: %s (%s)", job.ID, event.Type, event.Status)
+		if event.Type == events.JobFinished {
+			payload.DriverOutputURI = job.DriverOutputPath
+			payload.Reason = job.FailureReason
+			if job.FailureReason != "" {
+				payload.Text += ": " + job.FailureReason
+			}
+		}
+	} else {
+		payload.Text = fmt.Sprintf("OBI cluster %s hosting job %d: %s (%s)", event.ClusterName, job.ID,
+			event.Type, event.Status)
+	}
+	return payload
+}
+
+// deliverDue tries the deliveries of the outbox which are due
+func (n *Notifier) deliverDue() {
+	deliveries, err := persistent.GetDueWebhookDeliveries(time.Now(), outboxBatch)
+	if err != nil {
+		logrus.WithField("error", err).Error("Unable to load webhook deliveries from database")
+		return
+	}
+	for _, delivery := range deliveries {
+		n.deliver(delivery)
+	}
+}
+
+// deliver posts the payload to the webhook, scheduling a retry with exponential backoff if it fails
+func (n *Notifier) deliver(delivery *model.WebhookDelivery) {
+	err := n.post(delivery)
+	if err == nil {
+		delivery.Delivered = time.Now()
+		delivery.NextAttempt = time.Time{}
+		delivery.LastError = ""
+	} else {
+		delivery.Attempts++
+		delivery.LastError = err.Error()
+		logger := logrus.WithFields(logrus.Fields{
+			"webhookID": delivery.WebhookID,
+			"attempts":  delivery.Attempts,
+			"error":     err,
+		})
+		if delivery.Attempts >= n.MaxAttempts {
+			delivery.NextAttempt = time.Time{}
+			logger.Warning("Giving up webhook delivery")
+		} else {
+			delivery.NextAttempt = time.Now().Add(n.backoff(delivery.Attempts))
+			logger.Info("Webhook delivery failed, retrying later")
+		}
+	}
+	persistent.Write(delivery)
+}
+
+func (n *Notifier) post(delivery *model.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(delivery.Secret, delivery.Payload))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// backoff returns how long to wait before the next delivery after the given number of failed attempts
+func (n *Notifier) backoff(attempts int32) time.Duration {
+	backoff := time.Duration(n.Backoff) * time.Second
+	for i := int32(1); i < attempts && backoff < time.Duration(n.MaxBackoff)*time.Second; i++ {
+		backoff *= 2
+	}
+	if max := time.Duration(n.MaxBackoff) * time.Second; backoff > max {
+		backoff = max
+	}
+	return backoff
+}
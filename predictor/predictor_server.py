@@ -23,6 +23,7 @@ import predictor_service_pb2
 import predictor_service_pb2_grpc
 import predictor_utils
 import predictors
+import resources
 from logger import log
 
 sys.path.append('.')
@@ -53,10 +54,17 @@ class PredictorServer(predictor_service_pb2_grpc.ObiPredictorServicer):
         log.info('Received request {}'.format(req))
         # Select the correct predictor
         job_type = predictor_utils.infer_predictor_name(req)
+        peak_memory_mb, vcores = resources.estimate_resources(job_type)
+        # A negative probability tells the master that it is unknown
+        failure_probability = predictors.predict_failure(req.Metrics, job_type)
+        if failure_probability is None:
+            failure_probability = -1.0
         if job_type is None:
             return predictor_service_pb2.PredictionResponse(
                 Duration=-1,
-                FailureProbability=.0
+                FailureProbability=failure_probability,
+                PeakMemoryMB=peak_memory_mb,
+                VCores=vcores
             )
         predictor = predictors.get_predictor_instance(job_type)
         # Get job arguments
@@ -82,8 +90,10 @@ class PredictorServer(predictor_service_pb2_grpc.ObiPredictorServicer):
         # Return predictions to the user
         res = predictor_service_pb2.PredictionResponse()
         res.Duration = int(predictions)
-        res.FailureProbability = 0.0  # predictions[1]
+        res.FailureProbability = failure_probability
         res.Label = job_type
+        res.PeakMemoryMB = peak_memory_mb
+        res.VCores = vcores
         log.info('Generated predictions: {}'.format(res))
         return res
 
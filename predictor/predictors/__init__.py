@@ -53,13 +53,14 @@ def get_duration_predictor(predictor_name):
     return _DURATION_PREDICTORS[predictor_name]
 
 
-def predict_failure(data):
+def predict_failure(metrics, job_type):
     """
     Generate failure prediction for the given job information
-    :param data:
-    :return:
+    :param metrics:
+    :param job_type: inferred job type, or None if it is unknown
+    :return: failure probability, None if it cannot be predicted
     """
-    return _FAILURE_PREDICTOR.predict(data)
+    return _FAILURE_PREDICTOR.predict(metrics, job_type=job_type)
 
 
 def predict_scaling_factor(metrics, performance_before):
@@ -12,17 +12,30 @@
 #     See the License for the specific language governing permissions and
 #     limitations under the License.
 
+import csv
+import os
+
 from .generic_predictor import GenericPredictor
 
+from logger import log
+
 
 class FailurePredictor(GenericPredictor):
     """
     This class defines the methods to generate failure probability given a job
     and its respective profile.
+    The probability is the failure rate observed in the history of the jobs of
+    the same type, or of all the jobs if the type has no history
     """
 
-    def __init__(self):
-        self._load_model()
+    def __init__(self, history_path=None):
+        if history_path is None:
+            history_path = os.path.join(os.environ['BUCKET_DIRECTORY'],
+                                        'models',
+                                        'failure',
+                                        'history.csv')
+        self._history = dict()
+        self._load_model(history_path)
 
     def predict(self, metrics, **kwargs):
         """
@@ -31,11 +44,33 @@ class FailurePredictor(GenericPredictor):
         function a snapshot of the metrics for the cluster on which he is
         trying to execute the job and the input size information.
         :param metrics:
-        :return int: Duration prediction in seconds
+        :param job_type: inferred job type, or None if it is unknown
+        :return float: Failure probability, None if there is no history
         """
+        job_type = kwargs.get('job_type')
+        if job_type in self._history:
+            runs, failures = self._history[job_type]
+        else:
+            runs = sum(r for r, _ in self._history.values())
+            failures = sum(f for _, f in self._history.values())
+        if runs == 0:
+            return None
+        # Laplace smoothing keeps the probability of types with a short
+        # history away from 0 and 1
+        return (failures + 1) / (runs + 2)
 
-    def _load_model(self):
+    def _load_model(self, history_path):
         """
-        Loads a pre-trained model
+        Loads the number of runs and failures of each job type from a CSV file
+        with the job_type, runs and failures columns
+        :param history_path: path of the CSV file
         :return:
         """
+        if not os.path.exists(history_path):
+            log.warning('No job history found at {}: failure probabilities '
+                        'will not be predicted'.format(history_path))
+            return
+        with open(history_path, 'r') as f:
+            for row in csv.DictReader(f):
+                self._history[row['job_type']] = (int(row['runs']),
+                                                  int(row['failures']))
@@ -0,0 +1,96 @@
+# Copyright 2018 Delivery Hero Germany
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+#     Unless required by applicable law or agreed to in writing, software
+#     distributed under the License is distributed on an "AS IS" BASIS,
+#     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+#     See the License for the specific language governing permissions and
+#     limitations under the License.
+
+import csv
+import os
+
+from logger import log
+
+# Resources reserved for a job whose usage is not known: one YARN container
+# of the default Dataproc size. They can be overridden through the
+# DEFAULT_PEAK_MEMORY_MB and DEFAULT_VCORES environment variables.
+DEFAULT_PEAK_MEMORY_MB = 3072
+DEFAULT_VCORES = 1
+
+
+def load_estimates(path):
+    """
+    Load the peak usage measured for the known job types from a CSV file with
+    the job_type, peak_memory_mb and vcores columns
+    :param path: path of the CSV file
+    :return: dictionary mapping each job type to its memory MB and vcores
+    """
+    if path is None or not os.path.exists(path):
+        log.warning('No resource estimates found at {}: every job will get '
+                    'the default resources'.format(path))
+        return {}
+    estimates = {}
+    with open(path, 'r') as f:
+        for row in csv.DictReader(f):
+            estimates[row['job_type']] = (int(row['peak_memory_mb']),
+                                          int(row['vcores']))
+    log.info('Loaded resource estimates for {}'.format(
+        sorted(estimates.keys())))
+    return estimates
+
+
+def _estimates_path():
+    """
+    Return the path of the resource estimates, which can be overridden through
+    the RESOURCE_ESTIMATES_PATH environment variable
+    :return:
+    """
+    if 'RESOURCE_ESTIMATES_PATH' in os.environ:
+        return os.environ['RESOURCE_ESTIMATES_PATH']
+    if 'BUCKET_DIRECTORY' in os.environ:
+        return os.path.join(os.environ['BUCKET_DIRECTORY'],
+                            'models',
+                            'resources.csv')
+    return None
+
+
+# Measured peak usage of the known job types, as (memory MB, virtual cores).
+# Job types which are not listed here get the default resources.
+RESOURCE_ESTIMATES = load_estimates(_estimates_path())
+
+
+def _env_int(name, default):
+    """
+    Read a positive integer from the environment
+    :param name: name of the environment variable
+    :param default: value returned when the variable is unset or invalid
+    :return:
+    """
+    try:
+        value = int(os.environ.get(name, default))
+    except ValueError:
+        return default
+    return value if value > 0 else default
+
+
+def estimate_resources(job_type):
+    """
+    Estimate the peak resources needed by a job, so that the master can pack
+    it into a bin and size its cluster
+    :param job_type: inferred job type, or None if it is unknown
+    :return: tuple of peak memory in MB and virtual cores
+    """
+    if job_type in RESOURCE_ESTIMATES:
+        return RESOURCE_ESTIMATES[job_type]
+    # Every job estimated this way weighs the same in resource based bins,
+    # which are then packed as count based ones
+    log.warning('No resource estimate for job type {}: using the '
+                'defaults'.format(job_type))
+    return (_env_int('DEFAULT_PEAK_MEMORY_MB', DEFAULT_PEAK_MEMORY_MB),
+            _env_int('DEFAULT_VCORES', DEFAULT_VCORES))
@@ -0,0 +1,68 @@
+# Copyright 2018 Delivery Hero Germany
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+#     Unless required by applicable law or agreed to in writing, software
+#     distributed under the License is distributed on an "AS IS" BASIS,
+#     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+#     See the License for the specific language governing permissions and
+#     limitations under the License.
+
+import os
+import sys
+import tempfile
+import types
+import unittest
+
+sys.path.append(os.path.join(os.path.dirname(__file__), '..'))
+
+# Import the failure predictor without loading the duration models, which the
+# predictors package instantiates when it is imported
+_package = types.ModuleType('predictors')
+_package.__path__ = [os.path.join(os.path.dirname(__file__), '..',
+                                  'predictors')]
+sys.modules.setdefault('predictors', _package)
+
+from predictors.failure_predictor import FailurePredictor  # noqa: E402
+
+
+class FailurePredictorTest(unittest.TestCase):
+
+    def setUp(self):
+        self._history = tempfile.NamedTemporaryFile('w', suffix='.csv')
+        self._history.write('job_type,runs,failures\n'
+                            'ulm,98,48\n'
+                            'csv_find,8,0\n')
+        self._history.flush()
+        self.predictor = FailurePredictor(self._history.name)
+
+    def tearDown(self):
+        self._history.close()
+
+    def test_known_job_type(self):
+        self.assertAlmostEqual(
+            self.predictor.predict(None, job_type='ulm'), .49)
+
+    def test_smoothing(self):
+        # A type which never failed still gets a positive probability
+        self.assertAlmostEqual(
+            self.predictor.predict(None, job_type='csv_find'), .1)
+
+    def test_unknown_job_type_gets_overall_rate(self):
+        self.assertAlmostEqual(
+            self.predictor.predict(None, job_type=None), 49 / 108)
+        self.assertAlmostEqual(
+            self.predictor.predict(None, job_type='csv_update'), 49 / 108)
+
+    def test_no_history(self):
+        with self.assertLogs(level='WARNING'):
+            predictor = FailurePredictor('/nonexistent.csv')
+        self.assertIsNone(predictor.predict(None, job_type='ulm'))
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,80 @@
+# Copyright 2018 Delivery Hero Germany
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+#     Unless required by applicable law or agreed to in writing, software
+#     distributed under the License is distributed on an "AS IS" BASIS,
+#     WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+#     See the License for the specific language governing permissions and
+#     limitations under the License.
+
+import os
+import sys
+import tempfile
+import unittest
+from unittest import mock
+
+sys.path.append(os.path.join(os.path.dirname(__file__), '..'))
+
+import resources  # noqa: E402
+
+
+class EstimateResourcesTest(unittest.TestCase):
+
+    @mock.patch.dict(os.environ, {}, clear=True)
+    def test_unknown_job_gets_default(self):
+        self.assertEqual(resources.estimate_resources(None),
+                         (resources.DEFAULT_PEAK_MEMORY_MB,
+                          resources.DEFAULT_VCORES))
+
+    @mock.patch.dict(os.environ, {'DEFAULT_PEAK_MEMORY_MB': '8192',
+                                  'DEFAULT_VCORES': '4'})
+    def test_default_from_environment(self):
+        self.assertEqual(resources.estimate_resources('ulm'), (8192, 4))
+
+    @mock.patch.dict(os.environ, {'DEFAULT_PEAK_MEMORY_MB': 'lots',
+                                  'DEFAULT_VCORES': '-1'})
+    def test_invalid_environment_is_ignored(self):
+        self.assertEqual(resources.estimate_resources('ulm'),
+                         (resources.DEFAULT_PEAK_MEMORY_MB,
+                          resources.DEFAULT_VCORES))
+
+    @mock.patch.dict(resources.RESOURCE_ESTIMATES, {'ulm': (12288, 6)})
+    def test_known_job_type(self):
+        self.assertEqual(resources.estimate_resources('ulm'), (12288, 6))
+        self.assertEqual(resources.estimate_resources('csv_find'),
+                         (resources.DEFAULT_PEAK_MEMORY_MB,
+                          resources.DEFAULT_VCORES))
+
+    def test_defaults_are_logged(self):
+        with self.assertLogs(level='WARNING') as logs:
+            resources.estimate_resources('ulm')
+        self.assertIn('ulm', logs.output[0])
+
+    def test_load_estimates(self):
+        with tempfile.NamedTemporaryFile('w', suffix='.csv') as f:
+            f.write('job_type,peak_memory_mb,vcores\n'
+                    'ulm,12288,6\n'
+                    'csv_find,4096,2\n')
+            f.flush()
+            self.assertEqual(resources.load_estimates(f.name),
+                             {'ulm': (12288, 6), 'csv_find': (4096, 2)})
+
+    def test_missing_estimates(self):
+        with self.assertLogs(level='WARNING'):
+            self.assertEqual(resources.load_estimates('/nonexistent.csv'), {})
+        with self.assertLogs(level='WARNING'):
+            self.assertEqual(resources.load_estimates(None), {})
+
+    def test_estimates_are_positive(self):
+        memory, vcores = resources.estimate_resources(None)
+        self.assertGreater(memory, 0)
+        self.assertGreater(vcores, 0)
+
+
+if __name__ == '__main__':
+    unittest.main()
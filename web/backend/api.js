@@ -115,6 +115,20 @@ router.get('/job/:id', auth_verifier, [ sanitize(['id']) ], async function(req,
     }
 });
 
+router.get('/job/:id/promotions', auth_verifier, [ sanitize(['id']) ], async function(req, res) {
+    // Execute query
+    const q = 'select * from jobpromotion where jobid=$1 order by timestamp';
+    const v = [req.params.id];
+
+    try {
+        let qres = await DB.query(q, v);
+        return sendList(res, qres.rows, true);
+    } catch (err) {
+        console.error(err);
+        return res.sendStatus(401)
+    }
+});
+
 // User data routes
 
 router.get('/user/:id', auth_verifier, [ sanitize(['id']) ], async function(req, res) {